@@ -4,4 +4,6 @@ go 1.19
 
 require gonum.org/v1/gonum v0.13.0
 
-require golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
+require golang.org/x/exp v0.0.0-20230321023759-10a507213a29
+
+require github.com/klauspost/compress v1.16.7
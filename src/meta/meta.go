@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: MIT
+
+// Package meta has the statistical methods used by MMP::io to combine the
+// summary stats of several studies. They work on typed values, so they can be
+// used without the rest of MMP::io.
+package meta
+
+import (
+	"math"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Src is the source of randomness of the distributions used by the methods.
+// The current methods are deterministic, but methods drawing samples, such as
+// permutation tests, must use it so that a seeded source gives reproducible
+// results. When nil, the global source of golang.org/x/exp/rand is used.
+var Src rand.Source
+
+// The effect of a single study, as used in the meta-analysis.
+type StudyEffect struct {
+	Tag    string
+	Beta   float64
+	SEBeta float64
+	PVal   float64
+	AF     float64
+	N      float64
+}
+
+// Typed result of the meta-analysis, callers format it as they need.
+type MetaResult struct {
+	Beta   float64
+	SEBeta float64
+	PVal   float64
+	// Computed in log space, so it stays accurate when PVal underflows
+	NegLog10PVal float64
+	HetPVal      float64
+	Q            float64
+	I2           float64
+	NStudies     int
+}
+
+// ComputeMeta does an inverse-variance weighted fixed effect meta-analysis
+// with a Cochran's Q heterogeneity test.
+// The results are NaN when a study has a standard error that is not positive,
+// as its weight is then infinite.
+func ComputeMeta(studies []StudyEffect) MetaResult {
+	for _, study := range studies {
+		if !(study.SEBeta > 0) {
+			nan := math.NaN()
+			return metaResult(nan, nan, nan, nan, len(studies))
+		}
+	}
+
+	invVar := make([]float64, len(studies))
+	for i, study := range studies {
+		invVar[i] = 1 / (study.SEBeta * study.SEBeta)
+	}
+
+	effInvVar := make([]float64, len(studies))
+	for i, study := range studies {
+		effInvVar[i] = study.Beta * invVar[i]
+	}
+
+	metaBeta := sum(effInvVar) / sum(invVar)
+	metaSEBeta := math.Sqrt(1 / sum(invVar))
+	metaZ := sum(effInvVar) / math.Sqrt(sum(invVar))
+
+	// Calculate metaHetPVal here
+	var betaDev []float64
+	for i, study := range studies {
+		betaDev = append(betaDev, invVar[i]*(study.Beta-metaBeta)*(study.Beta-metaBeta))
+	}
+	q := sum(betaDev)
+
+	return metaResult(metaBeta, metaSEBeta, metaZ, q, len(studies))
+}
+
+// ComputeMetaCorrelated does a fixed effect meta-analysis of studies whose
+// errors are correlated, for example because they share controls, with the
+// generalized least squares estimator of Lin and Sullivan (2009). The
+// covariance of the betas of studies i and j is
+// correlations[i][j] * SEBeta_i * SEBeta_j, and correlations[i][i] is 1.
+// Without correlations, this is the inverse-variance weighted meta-analysis.
+// The results are NaN when the covariance matrix is not positive definite.
+func ComputeMetaCorrelated(studies []StudyEffect, correlations [][]float64) MetaResult {
+	nStudies := len(studies)
+	covariance := mat.NewSymDense(nStudies, nil)
+	betas := mat.NewVecDense(nStudies, nil)
+	ones := mat.NewVecDense(nStudies, nil)
+	for i, study := range studies {
+		for j := i; j < nStudies; j++ {
+			covariance.SetSym(i, j, correlations[i][j]*study.SEBeta*studies[j].SEBeta)
+		}
+		betas.SetVec(i, study.Beta)
+		ones.SetVec(i, 1)
+	}
+
+	nan := math.NaN()
+	var cholesky mat.Cholesky
+	if !cholesky.Factorize(covariance) {
+		return metaResult(nan, nan, nan, nan, nStudies)
+	}
+
+	var invCovOnes, invCovBetas mat.VecDense
+	err := cholesky.SolveVecTo(&invCovOnes, ones)
+	if err == nil {
+		err = cholesky.SolveVecTo(&invCovBetas, betas)
+	}
+	if err != nil {
+		return metaResult(nan, nan, nan, nan, nStudies)
+	}
+
+	// Sum of the weights, 1' V^-1 1, and of the weighted betas, 1' V^-1 b
+	sumWeights := mat.Dot(ones, &invCovOnes)
+	sumWeightedBetas := mat.Dot(ones, &invCovBetas)
+
+	metaBeta := sumWeightedBetas / sumWeights
+	metaSEBeta := math.Sqrt(1 / sumWeights)
+	metaZ := sumWeightedBetas / math.Sqrt(sumWeights)
+
+	// Generalized Cochran's Q: (b - beta 1)' V^-1 (b - beta 1)
+	q := mat.Dot(betas, &invCovBetas) - metaBeta*sumWeightedBetas
+
+	return metaResult(metaBeta, metaSEBeta, metaZ, math.Max(0, q), nStudies)
+}
+
+func metaResult(metaBeta float64, metaSEBeta float64, metaZ float64, q float64, nStudies int) MetaResult {
+	// Q has a chi-squared distribution with k-1 degrees of freedom under
+	// the hypothesis of homogeneity. A single study has no heterogeneity to
+	// test.
+	metaHetPVal := math.NaN()
+	if nStudies > 1 {
+		metaHetPVal = 1 - distuv.ChiSquared{
+			K:   float64(nStudies - 1),
+			Src: Src,
+		}.CDF(q)
+	}
+
+	// Share of the variation due to heterogeneity rather than chance
+	i2 := 0.0
+	if q > 0 && nStudies > 1 {
+		i2 = math.Max(0, (q-float64(nStudies-1))/q)
+	} else if math.IsNaN(q) {
+		i2 = q
+	}
+
+	return MetaResult{
+		Beta:         metaBeta,
+		SEBeta:       metaSEBeta,
+		PVal:         NormalPVal(metaZ),
+		HetPVal:      metaHetPVal,
+		NegLog10PVal: NormalNegLog10PVal(metaZ),
+		Q:            q,
+		I2:           i2,
+		NStudies:     nStudies,
+	}
+}
+
+// NormalPVal is the two-sided p-value of a z-score. It is computed with the
+// complementary error function, which keeps its precision far in the tail,
+// and is the smallest positive float instead of 0 when it underflows.
+func NormalPVal(z float64) float64 {
+	pval := math.Erfc(math.Abs(z) / math.Sqrt2)
+	if pval == 0 {
+		return math.SmallestNonzeroFloat64
+	}
+	return pval
+}
+
+// NormalNegLog10PVal is the -log10 of the two-sided p-value of a z-score,
+// computed in log space so that it is still accurate when the p-value
+// underflows, up to |z| in the hundreds.
+func NormalNegLog10PVal(z float64) float64 {
+	x := math.Abs(z) / math.Sqrt2
+	if x < 26 {
+		return -math.Log10(math.Erfc(x))
+	}
+
+	// Asymptotic expansion of erfc(x) for large x
+	x2 := x * x
+	series := 1 - 1/(2*x2) + 3/(4*x2*x2) - 15/(8*x2*x2*x2)
+	logPVal := -x2 - math.Log(x*math.Sqrt(math.Pi)) + math.Log(series)
+	return -logPVal / math.Ln10
+}
+
+// NegLog10 is the -log10 of a positive number. math.Log10 is inaccurate for
+// subnormal numbers, such as the p-values below 2.2e-308, so these are first
+// scaled up by 2^52.
+func NegLog10(x float64) float64 {
+	if x > 0 && x < 0x1p-1022 {
+		return -(math.Log10(x*0x1p52) - 52*math.Log10(2))
+	}
+	return -math.Log10(x)
+}
+
+// NormalZ is the absolute z-score of a two-sided -log10 p-value, the inverse
+// of NormalNegLog10PVal.
+func NormalZ(negLog10PVal float64) float64 {
+	if negLog10PVal < 300 {
+		return -distuv.UnitNormal.Quantile(math.Pow(10, -negLog10PVal) / 2)
+	}
+
+	// The p-value would underflow, so NormalNegLog10PVal is inverted by bisection
+	low, high := 0.0, 1e4
+	for ii := 0; ii < 100; ii++ {
+		middle := (low + high) / 2
+		if NormalNegLog10PVal(middle) < negLog10PVal {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return (low + high) / 2
+}
+
+// LiabilityScaleFactor converts effects of a binary trait on the observed 0/1
+// scale, from a study with the given sample prevalence, to the liability scale
+// of a trait with the given population prevalence K:
+// K(1-K) / (φ(Φ⁻¹(1-K)) sqrt(P(1-P))).
+func LiabilityScaleFactor(prevalence float64, samplePrevalence float64) float64 {
+	threshold := distuv.UnitNormal.Quantile(1 - prevalence)
+	density := distuv.UnitNormal.Prob(threshold)
+	return prevalence * (1 - prevalence) / (density * math.Sqrt(samplePrevalence*(1-samplePrevalence)))
+}
+
+// EffectiveSampleSize of a case/control study, as used for binary traits.
+func EffectiveSampleSize(nCases float64, nControls float64) float64 {
+	return 4 / (1/nCases + 1/nControls)
+}
+
+// CombineFisher combines the p-values of the studies with Fisher's method.
+// Like NormalPVal, it is the smallest positive float instead of 0 when it
+// underflows.
+func CombineFisher(studies []StudyEffect) float64 {
+	statistic := 0.0
+	for _, study := range studies {
+		statistic += 2 * NegLog10(study.PVal) * math.Ln10
+	}
+
+	pval := distuv.ChiSquared{
+		K:   float64(2 * len(studies)),
+		Src: Src,
+	}.Survival(statistic)
+	if pval == 0 {
+		return math.SmallestNonzeroFloat64
+	}
+	return pval
+}
+
+// Absolute z-score of a two-sided p-value, going through its -log10 when
+// half of the p-value underflows.
+func pValZ(pval float64) float64 {
+	if pval/2 > 0 {
+		return -distuv.UnitNormal.Quantile(pval / 2)
+	}
+	return NormalZ(NegLog10(pval))
+}
+
+// CombineStouffer combines the two-sided p-values of the studies with
+// Stouffer's Z method, using the sign of beta as the direction of effect.
+// When weightByN is set, each study is weighted by the square root of its
+// sample size.
+func CombineStouffer(studies []StudyEffect, weightByN bool) float64 {
+	weightedZ := 0.0
+	sumSquaredWeights := 0.0
+	for _, study := range studies {
+		weight := 1.0
+		if weightByN {
+			weight = math.Sqrt(study.N)
+		}
+
+		z := math.Copysign(pValZ(study.PVal), study.Beta)
+		weightedZ += weight * z
+		sumSquaredWeights += weight * weight
+	}
+
+	combinedZ := weightedZ / math.Sqrt(sumSquaredWeights)
+	return NormalPVal(combinedZ)
+}
+
+// Result of the MR-MEGA-style meta-regression
+type MRMEGAResult struct {
+	PVal            float64
+	AncestryHetPVal float64
+}
+
+// ComputeMRMEGA regresses the per-study effects on the ancestry principal
+// components of each study, weighting by inverse variance, as done in MR-MEGA
+// (Mägi et al. 2017).
+// PCs[i] holds the principal components of the study with effect Betas[i].
+// The p-values are NaN when the principal components are collinear across
+// the studies, or when there are not more studies than principal components
+// plus one, as the regression then has no residual degrees of freedom.
+func ComputeMRMEGA(Betas []float64, SEBetas []float64, PCs [][]float64) MRMEGAResult {
+	nStudies := len(Betas)
+	nPCs := len(PCs[0])
+	if nStudies <= nPCs+1 {
+		return MRMEGAResult{
+			PVal:            math.NaN(),
+			AncestryHetPVal: math.NaN(),
+		}
+	}
+
+	// Weighted least squares, done by scaling each row of the design matrix
+	// and of the response by the square root of its weight.
+	design := mat.NewDense(nStudies, nPCs+1, nil)
+	response := mat.NewVecDense(nStudies, nil)
+	invVar := make([]float64, nStudies)
+	for i := 0; i < nStudies; i++ {
+		invVar[i] = 1 / (SEBetas[i] * SEBetas[i])
+		sqrtWeight := math.Sqrt(invVar[i])
+
+		design.Set(i, 0, sqrtWeight)
+		for j := 0; j < nPCs; j++ {
+			design.Set(i, j+1, sqrtWeight*PCs[i][j])
+		}
+		response.SetVec(i, sqrtWeight*Betas[i])
+	}
+
+	var coefficients mat.VecDense
+	err := coefficients.SolveVec(design, response)
+	if err != nil {
+		// Principal components are collinear across the studies,
+		// the regression is not identifiable.
+		return MRMEGAResult{
+			PVal:            math.NaN(),
+			AncestryHetPVal: math.NaN(),
+		}
+	}
+
+	var fitted mat.VecDense
+	fitted.MulVec(design, &coefficients)
+
+	// Residual sum of squares of the full model, of the model with only
+	// an intercept, and of the null model with no effect at all.
+	rssFull := 0.0
+	rssNull := 0.0
+	for i := 0; i < nStudies; i++ {
+		residual := response.AtVec(i) - fitted.AtVec(i)
+		rssFull += residual * residual
+		rssNull += response.AtVec(i) * response.AtVec(i)
+	}
+
+	effInvVar := make([]float64, nStudies)
+	for i := range effInvVar {
+		effInvVar[i] = Betas[i] * invVar[i]
+	}
+	interceptBeta := sum(effInvVar) / sum(invVar)
+	rssIntercept := 0.0
+	for i := 0; i < nStudies; i++ {
+		rssIntercept += invVar[i] * (Betas[i] - interceptBeta) * (Betas[i] - interceptBeta)
+	}
+
+	assocPVal := distuv.ChiSquared{
+		K:   float64(nPCs + 1),
+		Src: Src,
+	}.Survival(rssNull - rssFull)
+
+	ancestryHetPVal := distuv.ChiSquared{
+		K:   float64(nPCs),
+		Src: Src,
+	}.Survival(rssIntercept - rssFull)
+
+	return MRMEGAResult{
+		PVal:            assocPVal,
+		AncestryHetPVal: ancestryHetPVal,
+	}
+}
+
+func sum(slice []float64) float64 {
+	total := 0.0
+	for _, v := range slice {
+		total += v
+	}
+	return total
+}
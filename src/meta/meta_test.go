@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+package meta
+
+import (
+	"math"
+	"testing"
+)
+
+func assertClose(t *testing.T, name string, expected float64, got float64) {
+	t.Helper()
+	if math.Abs(expected-got) > 1e-9*math.Max(1, math.Abs(expected)) {
+		t.Errorf("%s: expected %v, got %v", name, expected, got)
+	}
+}
+
+func TestComputeMeta(t *testing.T) {
+	// Weights of 1/0.05^2 = 400 and 1/0.1^2 = 100
+	result := ComputeMeta([]StudyEffect{
+		{Tag: "A", Beta: 0.1, SEBeta: 0.05},
+		{Tag: "B", Beta: 0.3, SEBeta: 0.1},
+	})
+
+	assertClose(t, "beta", (400*0.1+100*0.3)/500, result.Beta)
+	assertClose(t, "sebeta", math.Sqrt(1.0/500), result.SEBeta)
+	// z = 70 / sqrt(500) = 3.1305
+	assertClose(t, "pval", 0.001745118699528905, result.PVal)
+	assertClose(t, "-log10 pval", -math.Log10(0.001745118699528905), result.NegLog10PVal)
+	// Q = 400 * 0.04^2 + 100 * 0.16^2, with 1 degree of freedom
+	assertClose(t, "Q", 3.2, result.Q)
+	assertClose(t, "het pval", 0.07363827012030266, result.HetPVal)
+	assertClose(t, "I2", (3.2-1)/3.2, result.I2)
+	if result.NStudies != 2 {
+		t.Errorf("expected 2 studies, got %d", result.NStudies)
+	}
+}
+
+func TestComputeMetaSingleStudy(t *testing.T) {
+	result := ComputeMeta([]StudyEffect{{Tag: "A", Beta: 0.1, SEBeta: 0.05}})
+
+	assertClose(t, "beta", 0.1, result.Beta)
+	assertClose(t, "sebeta", 0.05, result.SEBeta)
+	assertClose(t, "pval", NormalPVal(2), result.PVal)
+	assertClose(t, "I2", 0, result.I2)
+	if !math.IsNaN(result.HetPVal) {
+		t.Errorf("expected a NaN heterogeneity p-value for a single study, got %v", result.HetPVal)
+	}
+}
+
+func TestComputeMetaZeroSEBeta(t *testing.T) {
+	result := ComputeMeta([]StudyEffect{
+		{Tag: "A", Beta: 0.1, SEBeta: 0},
+		{Tag: "B", Beta: 0.3, SEBeta: 0.1},
+	})
+
+	for name, value := range map[string]float64{
+		"beta":     result.Beta,
+		"sebeta":   result.SEBeta,
+		"pval":     result.PVal,
+		"het pval": result.HetPVal,
+		"I2":       result.I2,
+	} {
+		if !math.IsNaN(value) {
+			t.Errorf("%s: expected NaN with a standard error of 0, got %v", name, value)
+		}
+	}
+}
+
+func TestComputeMRMEGA(t *testing.T) {
+	// Reference values of the weighted least squares fit of the betas on one
+	// principal component: the residual sum of squares is 16/29 for the full
+	// model, 4 for the intercept-only model and 29 for the null model.
+	result := ComputeMRMEGA(
+		[]float64{0.1, 0.2, 0.3},
+		[]float64{0.05, 0.05, 0.1},
+		[][]float64{{0.1}, {0.2}, {0.5}},
+	)
+
+	// Chi-squared with 2 degrees of freedom for the association
+	assertClose(t, "pval", math.Exp(-(29-16.0/29)/2), result.PVal)
+	// Chi-squared with 1 degree of freedom for the ancestry heterogeneity
+	assertClose(t, "ancestry het pval", math.Erfc(math.Sqrt((4-16.0/29)/2)), result.AncestryHetPVal)
+}
+
+func TestComputeMRMEGANoResidualDF(t *testing.T) {
+	for _, pcs := range [][][]float64{
+		// As many studies as principal components plus one, fitted exactly
+		{{0.1}, {0.2}},
+		{{0.1, 0.3}, {0.2, 0.1}, {0.5, 0.2}},
+		// Fewer studies, the regression is not identifiable
+		{{0.1, 0.3}, {0.2, 0.1}},
+	} {
+		nStudies := len(pcs)
+		result := ComputeMRMEGA([]float64{0.1, 0.2, 0.3}[:nStudies], []float64{0.05, 0.05, 0.1}[:nStudies], pcs)
+		if !math.IsNaN(result.PVal) || !math.IsNaN(result.AncestryHetPVal) {
+			t.Errorf("expected NaN p-values for %d studies and %d principal components, got %+v", nStudies, len(pcs[0]), result)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+type ChromPos struct {
+	Chrom string
+	Pos   string
+}
+
+// The other inputs of a heterogeneity test with a reference can have a
+// variant of the reference with its ref and alt alleles swapped, so under
+// another CPRA. The swapped variants of the selection are then also selected,
+// so that their stats are read whichever input selected the variant.
+func addSwappedVariants(conf Conf, selectedVariants map[CPRA]bool) {
+	if !hasReferenceTest(conf) {
+		return
+	}
+
+	swappedVariants := make(map[CPRA]bool)
+	for cpra, significant := range selectedVariants {
+		if swapped := swappedCPRA(cpra); !selectedVariants[swapped] {
+			swappedVariants[swapped] = swappedVariants[swapped] || significant
+		}
+	}
+	for cpra, significant := range swappedVariants {
+		selectedVariants[cpra] = significant
+	}
+}
+
+func hasReferenceTest(conf Conf) bool {
+	for _, test := range conf.HeterogeneityTests {
+		if test.Reference != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func swappedCPRA(cpra CPRA) CPRA {
+	return CPRA{cpra.Chrom, cpra.Pos, cpra.Alt, cpra.Ref}
+}
+
+// Stats of the inputs of a heterogeneity test for a variant. With a reference,
+// the inputs of the test without stats for a variant of the reference use
+// their stats of the swapped variant, flipped on a copy, so that the stats of
+// the variants stay those of the inputs for the output and the other tests.
+// The swapped variant has then no stats for the test, as they are all with
+// the variant of the reference.
+func testStats(test HeterogeneityTestConf, cpra CPRA, variantStats map[CPRA][]OutputStats, inputs []InputConf) []OutputStats {
+	multipleStats := variantStats[cpra]
+	if test.Reference == "" {
+		return multipleStats
+	}
+
+	swappedStats := variantStats[swappedCPRA(cpra)]
+	if !hasStats(multipleStats, test.Reference) {
+		if hasStats(swappedStats, test.Reference) {
+			return nil
+		}
+		return multipleStats
+	}
+
+	alignedStats := append([]OutputStats(nil), multipleStats...)
+	for _, stats := range swappedStats {
+		if contains(test.Compare, stats.Tag) && !hasStats(multipleStats, stats.Tag) {
+			alignedStats = append(alignedStats, flipStats(stats, inputConfByTag(stats.Tag, inputs)))
+		}
+	}
+	return alignedStats
+}
+
+// Reports how many variants of the references are aligned in the other inputs,
+// and warns about the variants of the references that an input only has with
+// other alleles at their position, among the variants read, as they can't be
+// aligned with a swap.
+func checkReferenceAlignment(conf Conf, variantStats map[CPRA][]OutputStats) {
+	positionVariants := make(map[ChromPos][]CPRA)
+	for cpra := range variantStats {
+		position := ChromPos{cpra.Chrom, cpra.Pos}
+		positionVariants[position] = append(positionVariants[position], cpra)
+	}
+
+	for _, test := range conf.HeterogeneityTests {
+		if test.Reference == "" {
+			continue
+		}
+		for _, tag := range test.Compare {
+			if tag == test.Reference {
+				continue
+			}
+
+			nAligned := 0
+			nMismatched := 0
+			for cpra, multipleStats := range variantStats {
+				if !hasStats(multipleStats, test.Reference) || hasStats(multipleStats, tag) {
+					continue
+				}
+				if hasStats(variantStats[swappedCPRA(cpra)], tag) {
+					nAligned++
+					continue
+				}
+				for _, otherCPRA := range positionVariants[ChromPos{cpra.Chrom, cpra.Pos}] {
+					if hasStats(variantStats[otherCPRA], tag) {
+						nMismatched++
+						break
+					}
+				}
+			}
+
+			if nAligned > 0 {
+				fmt.Printf("- aligned %d variants of %s to the alleles of %s for %s\n", nAligned, tag, test.Reference, test.Tag)
+			}
+			if nMismatched > 0 {
+				log.Printf("WARNING: %d variants of the reference `%s` of heterogeneity test `%s` could not be aligned in `%s`, which has other alleles at their position.", nMismatched, test.Reference, test.Tag, tag)
+			}
+		}
+	}
+}
+
+// Whether the two variants are the same variant with swapped alleles, aligned
+// on the reference of a heterogeneity test comparing their inputs.
+func alignedOnReference(conf Conf, cpra CPRA, otherCPRA CPRA, variantStats map[CPRA][]OutputStats) bool {
+	if otherCPRA != swappedCPRA(cpra) {
+		return false
+	}
+	for _, test := range conf.HeterogeneityTests {
+		if test.Reference == "" {
+			continue
+		}
+		for _, variants := range [][2]CPRA{{cpra, otherCPRA}, {otherCPRA, cpra}} {
+			if !hasStats(variantStats[variants[0]], test.Reference) {
+				continue
+			}
+			for _, stats := range variantStats[variants[1]] {
+				if stats.Tag != test.Reference && contains(test.Compare, stats.Tag) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Stats of the other allele as effect allele. A minor allele frequency is the
+// same for both alleles.
+func flipStats(stats OutputStats, inputConf InputConf) OutputStats {
+	stats.Beta = flipSign(stats.Beta)
+
+	parsedAF, err := parseFloat64NaN(stats.AF)
+	logCheck("parsing AF as float", err)
+	if !math.IsNaN(parsedAF) && !inputConf.AFIsMAF {
+		stats.AF = formatFloat(1 - parsedAF)
+	}
+
+	return stats
+}
+
+// Stats are only combined for the same CPRA, so inputs having a variant with
+// its ref and alt alleles swapped, or on the other strand, end up in separate
+// variants at the same position and are never compared. These variants point
+// to a bug in the harmonization of the inputs or to a conflict in the data.
+// Different alt alleles at the same position are distinct variants, and the
+// variants aligned on the reference of a heterogeneity test are combined.
+func checkAlleleConsistency(conf Conf, variantStats map[CPRA][]OutputStats) {
+	positionVariants := make(map[ChromPos][]CPRA)
+	for cpra := range variantStats {
+		position := ChromPos{cpra.Chrom, cpra.Pos}
+		positionVariants[position] = append(positionVariants[position], cpra)
+	}
+
+	var mismatches []string
+	for position, cpras := range positionVariants {
+		sortCPRAs(cpras)
+		for ii, cpra := range cpras {
+			for _, otherCPRA := range cpras[ii+1:] {
+				if equivalentAlleles(cpra.Ref, cpra.Alt, otherCPRA.Ref, otherCPRA.Alt) && !alignedOnReference(conf, cpra, otherCPRA, variantStats) {
+					mismatches = append(mismatches, fmt.Sprintf("%s:%s has alleles %s/%s in %s and %s/%s in %s", position.Chrom, position.Pos, cpra.Ref, cpra.Alt, statsTags(variantStats[cpra]), otherCPRA.Ref, otherCPRA.Alt, statsTags(variantStats[otherCPRA])))
+				}
+			}
+		}
+	}
+	if len(mismatches) == 0 {
+		return
+	}
+
+	sort.Strings(mismatches)
+	nMismatches := len(mismatches)
+	const maxListed = 10
+	if nMismatches > maxListed {
+		mismatches = append(mismatches[:maxListed], "...")
+	}
+	log.Printf("WARNING: %d variants have alleles swapped or on the other strand between inputs, so their stats are not combined:\n- %s", nMismatches, strings.Join(mismatches, "\n- "))
+}
+
+func statsTags(multipleStats []OutputStats) string {
+	var tags []string
+	for _, stats := range multipleStats {
+		tags = append(tags, "`"+stats.Tag+"`")
+	}
+	return strings.Join(tags, ", ")
+}
+
+func equivalentAlleles(ref string, alt string, inputRef string, inputAlt string) bool {
+	for _, alleles := range [][2]string{
+		{inputRef, inputAlt},
+		{inputAlt, inputRef},
+		{complementAllele(inputRef), complementAllele(inputAlt)},
+		{complementAllele(inputAlt), complementAllele(inputRef)},
+	} {
+		if alleles[0] == ref && alleles[1] == alt {
+			return true
+		}
+	}
+	return false
+}
+
+var complementBases = map[rune]rune{'A': 'T', 'T': 'A', 'C': 'G', 'G': 'C'}
+
+// Strand complement of an allele, alleles with other bases are kept as they are.
+func complementAllele(allele string) string {
+	complement := []rune(allele)
+	for ii, base := range complement {
+		complementBase, found := complementBases[base]
+		if !found {
+			return allele
+		}
+		complement[ii] = complementBase
+	}
+	return string(complement)
+}
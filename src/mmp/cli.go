@@ -0,0 +1,1125 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+type InputConf struct {
+	Tag             string        `json:"tag"`
+	Filepath        string        `json:"filepath"`
+	Format          string        `json:"format"`
+	ColChrom        string        `json:"col_chrom"`
+	ColPos          string        `json:"col_pos"`
+	ColRef          string        `json:"col_ref"`
+	ColAlt          string        `json:"col_alt"`
+	ColPVal         ColumnList    `json:"col_pval"`
+	ColBeta         string        `json:"col_beta"`
+	ColSEBeta       string        `json:"col_sebeta"`
+	ColAF           string        `json:"col_af"`
+	ColEffectAllele string        `json:"col_effect_allele"`
+	ColPIP          string        `json:"col_pip"`
+	ColCS           string        `json:"col_cs"`
+	ColN            string        `json:"col_n"`
+	ColNCases       string        `json:"col_ncases"`
+	ColNControls    string        `json:"col_ncontrols"`
+	PValThreshold   PValThreshold `json:"pval_threshold"`
+	FinemapFilepath string        `json:"finemap_filepath"`
+	PC              []float64     `json:"pc"`
+	GenomeBuild     string        `json:"genome_build"`
+
+	FinemapCPRASeparator string `json:"finemap_cpra_separator"`
+
+	// Compression of the data files: gzip, bz2, zstd or uncompressed. Detected for
+	// each data file when not set or set to auto.
+	Compression string `json:"compression"`
+
+	// Single column with both alleles, such as A/G, instead of col_ref and
+	// col_alt. The first allele is the ref unless alleles_alt_first is set.
+	ColAlleles       string `json:"col_alleles"`
+	AllelesSeparator string `json:"alleles_separator"`
+	AllelesAltFirst  bool   `json:"alleles_alt_first"`
+
+	// Selection threshold derived from the p-values of the input at the given
+	// alpha, instead of the fixed pval_threshold
+	Selection string  `json:"selection"`
+	Alpha     float64 `json:"alpha"`
+
+	// Looser p-value threshold, the variants passing only this one are
+	// selected as suggestive instead of significant
+	SuggestiveThreshold PValThreshold `json:"suggestive_threshold"`
+
+	MinAF float64 `json:"min_af"`
+	MaxAF float64 `json:"max_af"`
+
+	ColInfo       string  `json:"col_info"`
+	InfoThreshold float64 `json:"info_threshold"`
+
+	FlipBeta bool `json:"flip_beta"`
+	FlipAF   bool `json:"flip_af"`
+
+	// AF given as a fraction (default) or a percentage, normalized to a fraction
+	AFScale string `json:"af_scale"`
+
+	// AF is a minor allele frequency, which can't be turned into the AF of the
+	// alt allele without knowing which allele is minor
+	AFIsMAF bool `json:"af_is_maf"`
+
+	// Multiplies beta and sebeta, for example to mix standardized and raw phenotypes
+	EffectScaleFactor float64 `json:"effect_scale_factor"`
+
+	SplitMultiallelic bool `json:"split_multiallelic"`
+
+	PValIsNegLog10 bool `json:"pval_is_neglog10"`
+
+	// -log10(p) column used to derive sebeta from beta when there is no col_sebeta
+	ColNegLog10P string `json:"col_neglog10p"`
+
+	// Only keep the primary contigs, or the given contigs
+	PrimaryContigsOnly bool     `json:"primary_contigs_only"`
+	Contigs            []string `json:"contigs"`
+
+	// Only keep the variants on chromosomes 1 to 22, also set by --autosomes-only
+	AutosomesOnly bool `json:"autosomes_only"`
+
+	// Population and sample prevalences of a binary trait, for the
+	// heterogeneity tests on the liability scale
+	Prevalence       float64 `json:"prevalence"`
+	SamplePrevalence float64 `json:"sample_prevalence"`
+
+	// discovery (default) inputs define the variant selection, replication
+	// inputs only contribute their stats for the selected variants
+	Role string `json:"role"`
+
+	// Ancestry group of the input, such as EUR, for the ancestry_tests
+	Ancestry string `json:"ancestry"`
+
+	// Free-form provenance of the input, such as cohort version, date or DOI,
+	// echoed to the run report and with --metadata-header to the output
+	Metadata map[string]string `json:"metadata"`
+
+	// Row kept when a variant has several rows: min_pval (default), first or last
+	Duplicates string `json:"duplicates"`
+
+	// What to do with p-values outside of [0, 1]: clamp (default), skip or fail
+	InvalidPVal string `json:"invalid_pval"`
+
+	// Remove the spaces around the values, as in hand-edited files
+	TrimSpaces bool `json:"trim_spaces"`
+
+	// Values meaning a missing value in this input, in addition to NA
+	NATokens []string `json:"na_tokens"`
+
+	// Columns copied as-is to the output, for example rsid or gene annotations
+	PassthroughColumns []string `json:"passthrough_columns"`
+
+	// Set from the annotations configuration for the inputs providing them
+	annotationColumns []string
+
+	// Pointer so that a missing key can default to true
+	HasHeader *bool `json:"has_header"`
+
+	// 0 for BED-like 0-based positions, pointer so that a missing key can default to 1
+	PositionBase *int `json:"position_base"`
+}
+
+// The p-value combination methods don't use the effect sizes, so they don't
+// have the inverse-variance weighted meta stats.
+func (test HeterogeneityTestConf) isIVW() bool {
+	return test.Combine == "" || test.Combine == "ivw"
+}
+
+func setDefaultVcfColumns(input *InputConf) {
+	if input.ColChrom == "" {
+		input.ColChrom = "#CHROM"
+	}
+	if input.ColPos == "" {
+		input.ColPos = "POS"
+	}
+	if input.ColRef == "" {
+		input.ColRef = "REF"
+	}
+	if input.ColAlt == "" {
+		input.ColAlt = "ALT"
+	}
+}
+
+// Variants with an AF outside of [min_af, max_af] are dropped.
+// A `max_af` of 0 means there is no upper bound, and variants with a missing AF are kept.
+func (inputConf InputConf) keepAF(af float64) bool {
+	if math.IsNaN(af) {
+		return true
+	}
+	if af < inputConf.MinAF {
+		return false
+	}
+	if inputConf.MaxAF != 0 && af > inputConf.MaxAF {
+		return false
+	}
+	return true
+}
+
+// Chromosomes of the primary assembly, with or without a "chr" prefix
+var primaryContigs = []string{
+	"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12",
+	"13", "14", "15", "16", "17", "18", "19", "20", "21", "22",
+	"X", "23", "Y", "24", "MT", "M", "25",
+}
+
+// Variants on decoy, ALT or patch contigs (for example 1_KI270711v1) can be
+// dropped. An explicit `contigs` list takes precedence over the primary contigs.
+func (inputConf InputConf) keepContig(chrom string) bool {
+	if len(inputConf.Contigs) > 0 {
+		return contains(inputConf.Contigs, chrom)
+	}
+	if inputConf.PrimaryContigsOnly {
+		return contains(primaryContigs, strings.TrimPrefix(chrom, "chr"))
+	}
+	return true
+}
+
+// Autosomes with or without a "chr" prefix, X and 23 are not
+func isAutosome(chrom string) bool {
+	return contains(primaryContigs[:22], strings.TrimPrefix(chrom, "chr"))
+}
+
+func (inputConf InputConf) allelesSeparator() string {
+	if inputConf.AllelesSeparator == "" {
+		return "/"
+	}
+	return inputConf.AllelesSeparator
+}
+
+// Separator of the chrom, pos, ref and alt in the variant column of finemap files
+func (inputConf InputConf) finemapCPRASeparator() string {
+	if inputConf.FinemapCPRASeparator == "" {
+		return ":"
+	}
+	return inputConf.FinemapCPRASeparator
+}
+
+// The compression set on the input, or else the one detected for the data file
+func (inputConf InputConf) compression(dataFilepath string) string {
+	if inputConf.Compression != "" && inputConf.Compression != "auto" {
+		return inputConf.Compression
+	}
+	return detectCompression(dataFilepath)
+}
+
+// An input filepath starting with @ is a manifest listing the data files of
+// the input, one per line. Relative paths are relative to the manifest directory.
+func (inputConf InputConf) isManifest() bool {
+	return strings.HasPrefix(inputConf.Filepath, "@")
+}
+
+func (inputConf InputConf) filepaths() []string {
+	if !inputConf.isManifest() {
+		return []string{inputConf.Filepath}
+	}
+
+	return readManifest(strings.TrimPrefix(inputConf.Filepath, "@"), inputConf.Tag)
+}
+
+// A finemap filepath starting with @ is also a manifest, for cohorts with
+// their finemapping split by region into many files.
+func (inputConf InputConf) finemapFilepaths() []string {
+	if !strings.HasPrefix(inputConf.FinemapFilepath, "@") {
+		return []string{inputConf.FinemapFilepath}
+	}
+	return readManifest(strings.TrimPrefix(inputConf.FinemapFilepath, "@"), inputConf.Tag)
+}
+
+func readManifest(manifestPath string, tag string) []string {
+	data, err := os.ReadFile(manifestPath)
+	logCheck("reading manifest file", err)
+
+	var dataFilepaths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(manifestPath), line)
+		}
+		dataFilepaths = append(dataFilepaths, line)
+	}
+	if len(dataFilepaths) == 0 {
+		fail("Manifest file `", manifestPath, "` of input `", tag, "` lists no data file.")
+	}
+
+	return dataFilepaths
+}
+
+// Whether some input has a suggestive threshold, in which case the selected
+// variants are either significant or only suggestive.
+func hasSuggestiveThreshold(inputs []InputConf) bool {
+	for _, inputConf := range inputs {
+		if inputConf.SuggestiveThreshold > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Headerless TSV files have their columns given as 1-based positions
+func (inputConf InputConf) hasHeader() bool {
+	return inputConf.HasHeader == nil || *inputConf.HasHeader
+}
+
+func (inputConf InputConf) positionBase() int {
+	if inputConf.PositionBase == nil {
+		return 1
+	}
+	return *inputConf.PositionBase
+}
+
+func (inputConf InputConf) isReplication() bool {
+	return inputConf.Role == "replication"
+}
+
+// Inputs whose p-value threshold defines the variant selection
+func discoveryInputs(inputs []InputConf) []InputConf {
+	var discovery []InputConf
+	for _, inputConf := range inputs {
+		if !inputConf.isReplication() {
+			discovery = append(discovery, inputConf)
+		}
+	}
+	return discovery
+}
+
+// The sample size of an input is either given directly, or computed as the
+// effective sample size from the number of cases and controls.
+func (inputConf InputConf) hasSampleSize() bool {
+	return inputConf.ColN != "" || inputConf.ColNCases != ""
+}
+
+// ColumnList can be given in the configuration file either as a single
+// column name or as a list of column names.
+type ColumnList []string
+
+func (columns *ColumnList) UnmarshalJSON(data []byte) error {
+	var single string
+	err := json.Unmarshal(data, &single)
+	if err == nil {
+		*columns = ColumnList{single}
+		return nil
+	}
+
+	var multiple []string
+	err = json.Unmarshal(data, &multiple)
+	if err != nil {
+		return err
+	}
+	*columns = multiple
+	return nil
+}
+
+// PValThreshold can be given in the configuration file either as a number or
+// as the name of a conventional threshold, to avoid miscounting zeros.
+type PValThreshold float64
+
+var pvalThresholdPresets = map[string]PValThreshold{
+	"genome_wide": 5e-8,
+	"suggestive":  1e-5,
+	"nominal":     0.05,
+}
+
+func (threshold *PValThreshold) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var preset string
+	err := json.Unmarshal(data, &preset)
+	if err == nil {
+		value, found := pvalThresholdPresets[preset]
+		if !found {
+			return fmt.Errorf("unrecognized p-value threshold `%s`, possible names are: genome_wide, suggestive, nominal", preset)
+		}
+		*threshold = value
+		return nil
+	}
+
+	var number float64
+	err = json.Unmarshal(data, &number)
+	if err != nil {
+		return err
+	}
+	*threshold = PValThreshold(number)
+	return nil
+}
+
+type HeterogeneityTestConf struct {
+	Tag       string   `json:"tag"`
+	Compare   []string `json:"compare"`
+	MRMEGA    bool     `json:"mr_mega"`
+	Combine   string   `json:"combine"`
+	WeightByN bool     `json:"weight_by_n"`
+
+	// Also compute a sample size weighted meta-analysis, to check the
+	// calibration of the standard errors of the inputs.
+	SampleSizeCheck bool `json:"sample_size_check"`
+
+	// Input whose alleles are used for the other inputs of the test, which
+	// are flipped when they have the alt and ref alleles swapped.
+	Reference string `json:"reference"`
+
+	// Convert the effects of the inputs to the liability scale of a binary
+	// trait before the meta-analysis, using their prevalences.
+	LiabilityScale bool `json:"liability_scale"`
+
+	// Leave the meta stats of a variant as NA when the betas of the compared
+	// inputs don't all have the same sign.
+	RequireConcordantDirection bool `json:"require_concordant_direction"`
+
+	// Minimum fraction of the selected variants of the test having stats from
+	// at least 2 of its inputs, with "warn" (default) or "fail" when below it.
+	MinOverlap   float64 `json:"min_overlap"`
+	OnLowOverlap string  `json:"on_low_overlap"`
+}
+
+type Conf struct {
+	Inputs             []InputConf             `json:"inputs"`
+	HeterogeneityTests []HeterogeneityTestConf `json:"heterogeneity_tests"`
+	Annotations        AnnotationConf          `json:"annotations"`
+
+	// Add a heterogeneity test for each ancestry of the inputs and one across
+	// all the inputs
+	AncestryTests bool `json:"ancestry_tests"`
+
+	// Correlations of the errors of pairs of inputs sharing samples, used
+	// by the inverse-variance weighted meta-analyses
+	SampleOverlap []SampleOverlapConf `json:"sample_overlap"`
+
+	// SHA-256 of the configuration file as read, for --header-comment
+	configHash string
+}
+
+// Correlation of the errors of two inputs sharing samples, such as controls.
+// It can be estimated as the correlation of the z-scores of the inputs over
+// the variants without association.
+type SampleOverlapConf struct {
+	Inputs      []string `json:"inputs"`
+	Correlation float64  `json:"correlation"`
+}
+
+// Variant-level columns, such as rsid, that are in the output only once per
+// variant instead of once per input.
+type AnnotationConf struct {
+	Source         string   `json:"source"`
+	Columns        []string `json:"columns"`
+	FallbackInputs []string `json:"fallback_inputs"`
+	WarnConflicts  bool     `json:"warn_conflicts"`
+}
+
+// Heterogeneity tests of the inputs of each ancestry, in the order the
+// ancestries first appear in the inputs, then of all the inputs. Ancestries
+// with a single input have no test.
+func ancestryTests(inputs []InputConf) []HeterogeneityTestConf {
+	var ancestries []string
+	ancestryTags := make(map[string][]string)
+	for _, inputConf := range inputs {
+		if inputConf.Ancestry == "" {
+			continue
+		}
+		if _, found := ancestryTags[inputConf.Ancestry]; !found {
+			ancestries = append(ancestries, inputConf.Ancestry)
+		}
+		ancestryTags[inputConf.Ancestry] = append(ancestryTags[inputConf.Ancestry], inputConf.Tag)
+	}
+
+	var tests []HeterogeneityTestConf
+	for _, ancestry := range ancestries {
+		if len(ancestryTags[ancestry]) < 2 {
+			log.Printf("WARNING: ancestry `%s` has a single input, it has no ancestry test.", ancestry)
+			continue
+		}
+		tests = append(tests, HeterogeneityTestConf{Tag: ancestry, Compare: ancestryTags[ancestry]})
+	}
+	if len(inputs) >= 2 {
+		tests = append(tests, HeterogeneityTestConf{Tag: "all", Compare: inputTags(inputs)})
+	}
+	return tests
+}
+
+// Print the configuration once validated, with the defaults of the optional
+// keys filled in, so that it shows what MMP::io will run.
+func PrintEffectiveConf(conf Conf) error {
+	data, err := json.MarshalIndent(effectiveConf(conf), "", "  ")
+	if err != nil {
+		return fmt.Errorf(":: encoding configuration :: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// The configuration as it will be run, with the defaults filled in
+func effectiveConf(conf Conf) Conf {
+	effective := conf
+	effective.Inputs = make([]InputConf, len(conf.Inputs))
+	for ii, input := range conf.Inputs {
+		hasHeader := input.hasHeader()
+		input.HasHeader = &hasHeader
+		positionBase := input.positionBase()
+		input.PositionBase = &positionBase
+		input.FinemapCPRASeparator = input.finemapCPRASeparator()
+		if input.ColAlleles != "" {
+			input.AllelesSeparator = input.allelesSeparator()
+		}
+		if input.Format == "" {
+			input.Format = "tsv"
+		}
+		if input.Selection == "" {
+			input.Selection = "threshold"
+		}
+		if input.Duplicates == "" {
+			input.Duplicates = "min_pval"
+		}
+		if input.InvalidPVal == "" {
+			input.InvalidPVal = "clamp"
+		}
+		if input.Role == "" {
+			input.Role = "discovery"
+		}
+		if input.AFScale == "" {
+			input.AFScale = "fraction"
+		}
+		if input.Compression == "" {
+			input.Compression = "auto"
+		}
+		effective.Inputs[ii] = input
+	}
+
+	effective.HeterogeneityTests = make([]HeterogeneityTestConf, len(conf.HeterogeneityTests))
+	for ii, test := range conf.HeterogeneityTests {
+		if test.Combine == "" {
+			test.Combine = "ivw"
+		}
+		if test.OnLowOverlap == "" {
+			test.OnLowOverlap = "warn"
+		}
+		effective.HeterogeneityTests[ii] = test
+	}
+
+	return effective
+}
+
+// ReadConf reads and validates the configuration file, or fetches it from an
+// http(s):// URL.
+func (runner *Runner) ReadConf(filePath string) (_ Conf, err error) {
+	defer runner.recoverFailure(&err)
+	runner.start()
+
+	data := readConfData(filePath)
+
+	var conf Conf
+	if runner.StrictConfig {
+		decoder := json.NewDecoder(bytes.NewReader(stripJSONComments(data)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&conf)
+		if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+			key := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			fail("Unknown key `", key, "` in the configuration file.", likelyConfigKey(key))
+		}
+	} else {
+		err = json.Unmarshal(stripJSONComments(data), &conf)
+	}
+	logCheck("parsing JSON conf", err)
+	conf.configHash = fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// Validate JSON.
+	// Go will not complain if there is a missing field in our input configuration file,
+	// instead it will fill it with its default type value.
+	// Since our fields are all required we manually check that all fields were provided
+	// in the input configuration file.
+	if conf.Inputs == nil {
+		runner.configError("Missing `inputs` field in the configuration file.")
+	}
+	if len(conf.Inputs) < 1 {
+		runner.configError("No summary stat provided in the configuration file. Need at least 1.")
+	}
+	for ii, input := range conf.Inputs {
+		if runner.AutosomesOnly {
+			conf.Inputs[ii].AutosomesOnly = true
+			input = conf.Inputs[ii]
+		}
+		switch input.Format {
+		case "", "tsv":
+		case "vcf":
+			if input.ColAlleles != "" {
+				runner.configError("`col_alleles` is not supported for the VCF input `", input.Tag, "`, which has REF and ALT columns.")
+			}
+			// VCF files have standard columns for the variant
+			setDefaultVcfColumns(&conf.Inputs[ii])
+			input = conf.Inputs[ii]
+		default:
+			runner.configError("Unrecognized `format` value `", input.Format, "` for input `", input.Tag, "`. Possible values are: tsv, vcf.")
+		}
+		switch input.Compression {
+		case "", "auto", "gzip", "bz2", "zstd", "uncompressed":
+		default:
+			runner.configError("Unrecognized `compression` value `", input.Compression, "` for input `", input.Tag, "`. Possible values are: auto, gzip, bz2, zstd, uncompressed.")
+		}
+		if input.Format == "vcf" && !input.hasHeader() {
+			runner.configError("`has_header` cannot be false for the VCF input `", input.Tag, "`.")
+		}
+
+		if input.Tag == "" {
+			runner.logMissingKey("tag", ii, "inputs")
+		}
+		if input.Filepath == "" {
+			runner.logMissingKey("filepath", ii, "inputs")
+		}
+		if input.ColChrom == "" {
+			runner.logMissingKey("col_chrom", ii, "inputs")
+		}
+		if input.ColPos == "" {
+			runner.logMissingKey("col_pos", ii, "inputs")
+		}
+		if input.ColAlleles != "" {
+			if input.ColRef != "" || input.ColAlt != "" {
+				runner.configError("Input `", input.Tag, "` has a `col_alleles`, it cannot also have a `col_ref` or `col_alt`.")
+			}
+			if input.SplitMultiallelic {
+				runner.configError("Input `", input.Tag, "` has a `col_alleles`, which is not supported with `split_multiallelic`.")
+			}
+		} else {
+			if input.ColRef == "" {
+				runner.logMissingKey("col_ref", ii, "inputs")
+			}
+			if input.ColAlt == "" {
+				runner.logMissingKey("col_alt", ii, "inputs")
+			}
+		}
+		if len(input.ColPVal) == 0 || contains(input.ColPVal, "") {
+			runner.logMissingKey("col_pval", ii, "inputs")
+		}
+		if input.ColBeta == "" {
+			runner.logMissingKey("col_beta", ii, "inputs")
+		}
+		if input.ColSEBeta == "" && input.ColNegLog10P == "" {
+			runner.logMissingKey("col_sebeta", ii, "inputs")
+		}
+		if input.ColAF == "" {
+			runner.logMissingKey("col_af", ii, "inputs")
+		}
+		switch input.AFScale {
+		case "", "fraction", "percent":
+		default:
+			runner.configError("Unrecognized `af_scale` value `", input.AFScale, "` for input `", input.Tag, "`. Possible values are: fraction, percent.")
+		}
+		if input.AFIsMAF && input.FlipAF {
+			runner.configError("Input `", input.Tag, "` has both `af_is_maf` and `flip_af`, but a minor allele frequency can't be flipped.")
+		}
+		switch input.Role {
+		case "", "discovery", "replication":
+		default:
+			runner.configError("Unrecognized `role` value `", input.Role, "` for input `", input.Tag, "`. Possible values are: discovery, replication.")
+		}
+		switch input.Selection {
+		case "", "threshold":
+			if input.PValThreshold == 0 && !input.isReplication() {
+				runner.logMissingKey("pval_threshold", ii, "inputs")
+			}
+		case "bonferroni", "fdr":
+			if input.Alpha <= 0 || input.Alpha >= 1 {
+				runner.configError("Input `", input.Tag, "` has `selection` ", input.Selection, " and needs an `alpha` between 0 and 1.")
+			}
+		default:
+			runner.configError("Unknown `selection` for input `", input.Tag, "`: ", input.Selection, ". Use `threshold`, `bonferroni` or `fdr`.")
+		}
+		// We don't check for the "fine_mapping_path", "col_effect_allele" and "genome_build" configuration keys as they are optional.
+		// Finemapping columns in the summary stats file are also optional, but must come together.
+		if (input.ColPIP == "") != (input.ColCS == "") {
+			runner.configError("Input `", input.Tag, "` needs both `col_pip` and `col_cs`, or none of them.")
+		}
+		if (input.ColNCases == "") != (input.ColNControls == "") {
+			runner.configError("Input `", input.Tag, "` needs both `col_ncases` and `col_ncontrols`, or none of them.")
+		}
+		if input.ColNCases != "" && input.ColN != "" {
+			runner.configError("Input `", input.Tag, "` has both `col_n` and `col_ncases`/`col_ncontrols`. The sample size must come from only one of them.")
+		}
+		if input.MinAF < 0 || input.MinAF > 1 || input.MaxAF < 0 || input.MaxAF > 1 {
+			runner.configError("Input `", input.Tag, "` has `min_af` or `max_af` outside of [0, 1].")
+		}
+		if input.MaxAF != 0 && input.MinAF > input.MaxAF {
+			runner.configError("Input `", input.Tag, "` has `min_af` greater than `max_af`.")
+		}
+		if input.SuggestiveThreshold < 0 || input.SuggestiveThreshold >= 1 {
+			runner.configError("Input `", input.Tag, "` has a `suggestive_threshold` outside of [0, 1).")
+		}
+		if input.SuggestiveThreshold > 0 && (input.Selection == "" || input.Selection == "threshold") && input.SuggestiveThreshold <= input.PValThreshold {
+			runner.configError("Input `", input.Tag, "` has a `suggestive_threshold` ", input.SuggestiveThreshold, " that is not above its `pval_threshold` ", input.PValThreshold, ".")
+		}
+		switch input.InvalidPVal {
+		case "", "clamp", "skip", "fail":
+		default:
+			runner.configError("Unrecognized `invalid_pval` value `", input.InvalidPVal, "` for input `", input.Tag, "`. Possible values are: clamp, skip, fail.")
+		}
+		if _, found := input.Metadata[""]; found {
+			runner.configError("Input `", input.Tag, "` has a `metadata` value with an empty key.")
+		}
+		switch input.Duplicates {
+		case "", "min_pval", "first", "last":
+		default:
+			runner.configError("Unrecognized `duplicates` value `", input.Duplicates, "` for input `", input.Tag, "`. Possible values are: min_pval, first, last.")
+		}
+		if input.positionBase() != 0 && input.positionBase() != 1 {
+			runner.configError("Input `", input.Tag, "` has `position_base` ", input.positionBase(), ". Possible values are: 0, 1.")
+		}
+		if input.EffectScaleFactor < 0 {
+			runner.configError("Input `", input.Tag, "` has a negative `effect_scale_factor`. It must be a positive number, use `flip_beta` to flip the sign of beta.")
+		}
+		if input.InfoThreshold != 0 && input.ColInfo == "" {
+			runner.configError("Input `", input.Tag, "` has `info_threshold` but no `col_info`.")
+		}
+		if input.ColPIP != "" && input.FinemapFilepath != "" {
+			runner.configError("Input `", input.Tag, "` has both `col_pip`/`col_cs` and `finemap_filepath`. Finemapping must come from only one of them.")
+		}
+	}
+
+	runner.validateUniqueTags(inputTags(conf.Inputs), "inputs")
+
+	if conf.HeterogeneityTests == nil && !conf.AncestryTests {
+		runner.configError("Missing `heterogeneity_tests` field in the configuration file.")
+	}
+	if conf.AncestryTests {
+		conf.HeterogeneityTests = append(conf.HeterogeneityTests, ancestryTests(conf.Inputs)...)
+	}
+	for jj, heterogeneity_test := range conf.HeterogeneityTests {
+		if heterogeneity_test.Tag == "" {
+			runner.logMissingKey("tag", jj, "heterogeneity_tests")
+		}
+		if heterogeneity_test.Compare == nil {
+			runner.logMissingKey("compare", jj, "heterogeneity_tests")
+		}
+		if len(heterogeneity_test.Compare) < 2 {
+			runner.configError("Need at least 2 GWAS to run heterogeneity test. Instead got: ", heterogeneity_test.Compare)
+		}
+		// The other checks of a test need its inputs
+		if !runner.validateCompareTags(heterogeneity_test, conf.Inputs) {
+			continue
+		}
+		switch heterogeneity_test.Combine {
+		case "", "ivw", "fisher", "stouffer":
+		default:
+			runner.configError("Unrecognized `combine` value `", heterogeneity_test.Combine, "` for heterogeneity test `", heterogeneity_test.Tag, "`. Possible values are: ivw, fisher, stouffer.")
+		}
+		if heterogeneity_test.WeightByN {
+			if heterogeneity_test.Combine != "stouffer" {
+				runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `weight_by_n` enabled, which is only supported with `\"combine\": \"stouffer\"`.")
+			}
+			for _, tag := range heterogeneity_test.Compare {
+				if !inputConfByTag(tag, conf.Inputs).hasSampleSize() {
+					runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `weight_by_n` enabled but input `", tag, "` has no `col_n` nor `col_ncases`/`col_ncontrols`.")
+				}
+			}
+		}
+		if heterogeneity_test.SampleSizeCheck {
+			if !heterogeneity_test.isIVW() {
+				runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `sample_size_check` enabled, which is only supported with the inverse-variance weighted meta-analysis.")
+			}
+			if !testHasSampleSize(heterogeneity_test, conf.Inputs) {
+				runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `sample_size_check` enabled but not all its inputs have a sample size.")
+			}
+		}
+		if heterogeneity_test.LiabilityScale {
+			if !heterogeneity_test.isIVW() {
+				runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `liability_scale` enabled, which is only supported with the inverse-variance weighted meta-analysis.")
+			}
+			for _, tag := range heterogeneity_test.Compare {
+				input := inputConfByTag(tag, conf.Inputs)
+				if input.Prevalence <= 0 || input.Prevalence >= 1 || input.SamplePrevalence <= 0 || input.SamplePrevalence >= 1 {
+					runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `liability_scale` enabled but input `", tag, "` has no `prevalence` and `sample_prevalence` between 0 and 1.")
+				}
+			}
+		}
+		if heterogeneity_test.RequireConcordantDirection && heterogeneity_test.Combine == "fisher" {
+			runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `require_concordant_direction` enabled, which is not supported with `\"combine\": \"fisher\"` as it doesn't use the direction of effect.")
+		}
+		if heterogeneity_test.MinOverlap < 0 || heterogeneity_test.MinOverlap > 1 {
+			runner.configError("Heterogeneity test `", heterogeneity_test.Tag, "` has `min_overlap` outside of [0, 1].")
+		}
+		switch heterogeneity_test.OnLowOverlap {
+		case "", "warn", "fail":
+		default:
+			runner.configError("Unrecognized `on_low_overlap` value `", heterogeneity_test.OnLowOverlap, "` for heterogeneity test `", heterogeneity_test.Tag, "`. Possible values are: warn, fail.")
+		}
+		if heterogeneity_test.Reference != "" && !contains(heterogeneity_test.Compare, heterogeneity_test.Reference) {
+			runner.configError("The `reference` of heterogeneity test `", heterogeneity_test.Tag, "` must be one of its compared inputs. Instead got: ", heterogeneity_test.Reference)
+		}
+		runner.validateGenomeBuilds(heterogeneity_test, conf.Inputs)
+		if heterogeneity_test.MRMEGA {
+			runner.validateMRMEGAConf(heterogeneity_test, conf.Inputs)
+		}
+	}
+
+	var testTags []string
+	for _, test := range conf.HeterogeneityTests {
+		testTags = append(testTags, test.Tag)
+	}
+	runner.validateUniqueTags(testTags, "heterogeneity_tests")
+
+	if len(conf.Annotations.Columns) > 0 {
+		runner.setAnnotationColumns(&conf)
+	}
+
+	runner.validateSampleOverlap(conf)
+
+	if len(discoveryInputs(conf.Inputs)) == 0 {
+		runner.configError("All the inputs have the `replication` role, at least one must be a `discovery` input to select variants.")
+	}
+	// Checked here rather than when clumping, so that a typo doesn't waste
+	// the scan of the inputs
+	if runner.ClumpBy != "min" && !contains(inputTags(conf.Inputs), runner.ClumpBy) {
+		runner.configError("Could not clump by `", runner.ClumpBy, "` (--clump-by): not an input tag. Use an input tag or `min`.")
+	}
+
+	if len(runner.configErrors) > 0 {
+		failf("%d errors in the configuration file:\n- %s", len(runner.configErrors), strings.Join(runner.configErrors, "\n- "))
+	}
+
+	return conf, nil
+}
+
+// Hint at the known configuration key closest to an unknown key, as it is
+// most likely a typo of it.
+func likelyConfigKey(unknownKey string) string {
+	keys := configKeys(reflect.TypeOf(Conf{}))
+
+	likelyKey := ""
+	minDistance := 4
+	for _, key := range keys {
+		if distance := editDistance(unknownKey, key); distance < minDistance {
+			likelyKey = key
+			minDistance = distance
+		}
+	}
+	if likelyKey == "" {
+		return ""
+	}
+	return fmt.Sprint(" Did you mean `", likelyKey, "`?")
+}
+
+// Keys of the configuration file, from the json tags of the fields of a
+// configuration type and of the configuration types nested in it
+func configKeys(confType reflect.Type) []string {
+	var keys []string
+	for ii := 0; ii < confType.NumField(); ii++ {
+		field := confType.Field(ii)
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		keys = append(keys, key)
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Map || fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(fieldType)...)
+		}
+	}
+	return keys
+}
+
+// Levenshtein distance between two strings
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for jj := range previous {
+		previous[jj] = jj
+	}
+	for ii := 1; ii <= len(a); ii++ {
+		current[0] = ii
+		for jj := 1; jj <= len(b); jj++ {
+			substitution := previous[jj-1]
+			if a[ii-1] != b[jj-1] {
+				substitution++
+			}
+			current[jj] = substitution
+			if previous[jj]+1 < current[jj] {
+				current[jj] = previous[jj] + 1
+			}
+			if current[jj-1]+1 < current[jj] {
+				current[jj] = current[jj-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func (runner *Runner) configError(values ...any) {
+	if runner.FailFast {
+		fail(values...)
+	}
+	runner.configErrors = append(runner.configErrors, fmt.Sprint(values...))
+}
+
+func inputTags(inputs []InputConf) []string {
+	var tags []string
+	for _, input := range inputs {
+		tags = append(tags, input.Tag)
+	}
+	return tags
+}
+
+// Tags are used for the output column names, so they must be unique in their section.
+func (runner *Runner) validateUniqueTags(tags []string, section string) {
+	seenTags := make(map[string]bool)
+	for _, tag := range tags {
+		if tag != "" && seenTags[tag] {
+			runner.configError("Duplicate tag `", tag, "` in the `", section, "` section of the configuration file.")
+		}
+		seenTags[tag] = true
+	}
+}
+
+func (runner *Runner) validateCompareTags(test HeterogeneityTestConf, inputs []InputConf) bool {
+	valid := true
+	for _, tag := range test.Compare {
+		if indexOfInput(tag, inputs) == -1 {
+			runner.configError("Heterogeneity test `", test.Tag, "` compares `", tag, "`, which is not the tag of any input.")
+			valid = false
+		}
+	}
+	return valid
+}
+
+// Check the annotations configuration and request the annotation columns
+// from the inputs providing them.
+func (runner *Runner) setAnnotationColumns(conf *Conf) {
+	if conf.Annotations.Source == "" {
+		runner.configError("Missing `source` key in `annotations`. This is the tag of the input providing the annotation columns.")
+	}
+
+	annotationTags := append([]string{conf.Annotations.Source}, conf.Annotations.FallbackInputs...)
+	for _, tag := range annotationTags {
+		if indexOfInput(tag, conf.Inputs) == -1 {
+			runner.configError("The annotations input `", tag, "` is not the tag of any input.")
+		}
+	}
+	if contains(conf.Annotations.FallbackInputs, conf.Annotations.Source) {
+		runner.configError("The annotations source `", conf.Annotations.Source, "` cannot also be in `fallback_inputs`.")
+	}
+
+	for ii, input := range conf.Inputs {
+		if contains(annotationTags, input.Tag) {
+			conf.Inputs[ii].annotationColumns = conf.Annotations.Columns
+		}
+	}
+}
+
+// The configuration is either a local file or fetched from an http(s):// URL.
+func readConfData(filePath string) []byte {
+	if !strings.HasPrefix(filePath, "http://") && !strings.HasPrefix(filePath, "https://") {
+		data, err := os.ReadFile(filePath)
+		logCheck("reading configuration file", err)
+		return data
+	}
+
+	data, err := fetchConfData(filePath)
+	logCheck("fetching configuration file", err)
+	return data
+}
+
+// A stalled server stops MMP::io with an error instead of hanging the run
+var confFetchClient = &http.Client{Timeout: 60 * time.Second}
+
+func fetchConfData(url string) ([]byte, error) {
+	response, err := confFetchClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch configuration file from `%s`: got HTTP status %s", url, response.Status)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// Allow JSONC in the configuration file: strip // and /* */ comments and
+// trailing commas, so that strict JSON parsing can be used afterwards.
+// Comment markers and commas inside strings are kept as they are.
+func stripJSONComments(data []byte) []byte {
+	var stripped []byte
+	inString := false
+
+	for ii := 0; ii < len(data); ii++ {
+		char := data[ii]
+
+		if inString {
+			stripped = append(stripped, char)
+			if char == '\\' && ii+1 < len(data) {
+				ii++
+				stripped = append(stripped, data[ii])
+			} else if char == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case char == '"':
+			inString = true
+			stripped = append(stripped, char)
+
+		case char == '/' && ii+1 < len(data) && data[ii+1] == '/':
+			for ii < len(data) && data[ii] != '\n' {
+				ii++
+			}
+			if ii < len(data) {
+				stripped = append(stripped, '\n')
+			}
+
+		case char == '/' && ii+1 < len(data) && data[ii+1] == '*':
+			ii += 2
+			for ii+1 < len(data) && !(data[ii] == '*' && data[ii+1] == '/') {
+				// Keep line breaks so that JSON error positions still make sense
+				if data[ii] == '\n' {
+					stripped = append(stripped, '\n')
+				}
+				ii++
+			}
+			ii++
+
+		case char == ']' || char == '}':
+			// Remove a trailing comma before the closing bracket
+			jj := len(stripped) - 1
+			for jj >= 0 && isJSONWhitespace(stripped[jj]) {
+				jj--
+			}
+			if jj >= 0 && stripped[jj] == ',' {
+				stripped = append(stripped[:jj], stripped[jj+1:]...)
+			}
+			stripped = append(stripped, char)
+
+		default:
+			stripped = append(stripped, char)
+		}
+	}
+
+	return stripped
+}
+
+func isJSONWhitespace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\n' || char == '\r'
+}
+
+// Inputs on different genome builds barely share any CPRA, which would silently
+// give a near-empty heterogeneity test. Inputs without a `genome_build` are not checked.
+func (runner *Runner) validateGenomeBuilds(test HeterogeneityTestConf, inputs []InputConf) {
+	var firstTag, firstBuild string
+	for _, tag := range test.Compare {
+		build := inputConfByTag(tag, inputs).GenomeBuild
+		if build == "" {
+			continue
+		}
+		if firstBuild == "" {
+			firstTag = tag
+			firstBuild = build
+		} else if build != firstBuild {
+			runner.configError("Heterogeneity test `", test.Tag, "` compares inputs on different genome builds: `", firstTag, "` is on `", firstBuild, "` but `", tag, "` is on `", build, "`. Lift over the summary stats to the same build first.")
+		}
+	}
+}
+
+// The MR-MEGA regression needs the same number of principal components for
+// every compared input, and at least 2 more inputs than principal components
+// so that both the association and the ancestry heterogeneity tests have
+// degrees of freedom left.
+func (runner *Runner) validateMRMEGAConf(test HeterogeneityTestConf, inputs []InputConf) {
+	nPCs := -1
+	for _, tag := range test.Compare {
+		pc := inputConfByTag(tag, inputs).PC
+		if len(pc) == 0 {
+			runner.configError("Heterogeneity test `", test.Tag, "` has `mr_mega` enabled but input `", tag, "` has no `pc` values.")
+		}
+		if nPCs == -1 {
+			nPCs = len(pc)
+		} else if len(pc) != nPCs {
+			runner.configError("Heterogeneity test `", test.Tag, "` has `mr_mega` enabled but its inputs have different numbers of `pc` values.")
+		}
+	}
+	if len(test.Compare) < nPCs+2 {
+		runner.configError("Heterogeneity test `", test.Tag, "` has `mr_mega` enabled with ", nPCs, " principal components, which needs at least ", nPCs+2, " inputs. Instead got: ", test.Compare)
+	}
+}
+
+func validateColumnGroups(groups string) {
+	splitGroups := strings.Split(groups, ",")
+	for _, group := range outputColumnGroups {
+		if !contains(splitGroups, group) {
+			fail("Missing `", group, "` in --column-groups `", groups, "`. It must list each of: ", strings.Join(outputColumnGroups, ", "), ".")
+		}
+	}
+	if len(splitGroups) != len(outputColumnGroups) {
+		fail("Invalid --column-groups `", groups, "`. It must list each of: ", strings.Join(outputColumnGroups, ", "), ", once.")
+	}
+}
+
+func (runner *Runner) logMissingKey(col_name string, element_index int, section string) {
+	runner.configError("Missing `", col_name, "` key of element #", element_index, " in the `", section, "` section of the configuration file. Check config.json.sample for reference.")
+}
+
+func (runner *Runner) validateSampleOverlap(conf Conf) {
+	pairs := make(map[[2]string]bool)
+	for _, overlap := range conf.SampleOverlap {
+		if len(overlap.Inputs) != 2 || overlap.Inputs[0] == overlap.Inputs[1] {
+			runner.configError("Each `sample_overlap` needs 2 different `inputs`. Instead got: ", overlap.Inputs)
+			continue
+		}
+		for _, tag := range overlap.Inputs {
+			if indexOfInput(tag, conf.Inputs) == -1 {
+				runner.configError("The `sample_overlap` input `", tag, "` is not the tag of any input.")
+			}
+		}
+		if overlap.Correlation <= -1 || overlap.Correlation >= 1 {
+			runner.configError("The `sample_overlap` of `", overlap.Inputs[0], "` and `", overlap.Inputs[1], "` has a `correlation` outside of (-1, 1).")
+		}
+		pair := [2]string{overlap.Inputs[0], overlap.Inputs[1]}
+		if pair[0] > pair[1] {
+			pair = [2]string{pair[1], pair[0]}
+		}
+		if pairs[pair] {
+			runner.configError("The inputs `", pair[0], "` and `", pair[1], "` have several `sample_overlap`.")
+		}
+		pairs[pair] = true
+	}
+
+	// The correlations of the inputs of a test must be those of some
+	// covariance, otherwise the meta-analysis can't be computed.
+	for _, test := range conf.HeterogeneityTests {
+		if !test.isIVW() || !hasSampleOverlap(test.Compare, conf.SampleOverlap) {
+			continue
+		}
+		studies := make([]meta.StudyEffect, len(test.Compare))
+		for ii, tag := range test.Compare {
+			studies[ii] = meta.StudyEffect{Tag: tag, Beta: 0, SEBeta: 1}
+		}
+		result := meta.ComputeMetaCorrelated(studies, overlapCorrelations(studies, conf.SampleOverlap))
+		if math.IsNaN(result.SEBeta) {
+			runner.configError("The `sample_overlap` correlations of the inputs of heterogeneity test `", test.Tag, "` are not the ones of a positive definite correlation matrix.")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchConfData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/config.json":
+			writer.Write([]byte(`{"inputs": []}`))
+		case "/stalled.json":
+			time.Sleep(time.Second)
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	data, err := fetchConfData(server.URL + "/config.json")
+	if err != nil || string(data) != `{"inputs": []}` {
+		t.Errorf("expected the configuration, got %q and error %v", data, err)
+	}
+
+	_, err = fetchConfData(server.URL + "/missing.json")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected an error with the HTTP status, got %v", err)
+	}
+
+	defaultClient := confFetchClient
+	confFetchClient = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { confFetchClient = defaultClient }()
+	_, err = fetchConfData(server.URL + "/stalled.json")
+	if err == nil {
+		t.Error("expected a timeout error for a stalled server")
+	}
+}
+
+func TestLikelyConfigKey(t *testing.T) {
+	for unknownKey, expected := range map[string]string{
+		"correlaton":                  " Did you mean `correlation`?",
+		"sampel_overlap":              " Did you mean `sample_overlap`?",
+		"fallback_input":              " Did you mean `fallback_inputs`?",
+		"require_concordant_directon": " Did you mean `require_concordant_direction`?",
+		"unrelated":                   "",
+	} {
+		if hint := likelyConfigKey(unknownKey); hint != expected {
+			t.Errorf("expected %q for `%s`, got %q", expected, unknownKey, hint)
+		}
+	}
+}
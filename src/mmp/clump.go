@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"math"
+	"sort"
+)
+
+// Keep only the lead variants: the most significant variant within the clumping
+// window, like PLINK's --clump but based on distance only (no LD).
+//
+// The p-value driving the clumping is either the p-value of the input with tag
+// clumpBy, or the minimum p-value across all inputs when clumpBy is "min".
+func clumpVariants(variantStats map[CPRA][]OutputStats, windowSize int64, clumpBy string) map[CPRA][]OutputStats {
+	// Group the variants by chromosome, then clump each chromosome independently.
+	chromVariants := make(map[string][]CPRA)
+	for cpra := range variantStats {
+		chromVariants[cpra.Chrom] = append(chromVariants[cpra.Chrom], cpra)
+	}
+
+	clumpedStats := make(map[CPRA][]OutputStats)
+	for _, cpras := range chromVariants {
+		sortCPRAs(cpras)
+		positions := make([]int64, len(cpras))
+		pvals := make([]float64, len(cpras))
+		for ii, cpra := range cpras {
+			positions[ii] = parsePos(cpra.Pos)
+			pvals[ii] = clumpingPVal(variantStats[cpra], clumpBy)
+		}
+
+		// Go through the variants from the most significant to the least significant.
+		bySignificance := make([]int, len(cpras))
+		for ii := range bySignificance {
+			bySignificance[ii] = ii
+		}
+		sort.SliceStable(bySignificance, func(i, j int) bool {
+			return pvals[bySignificance[i]] < pvals[bySignificance[j]]
+		})
+
+		clumped := make([]bool, len(cpras))
+		for _, lead := range bySignificance {
+			if clumped[lead] {
+				continue
+			}
+			clumpedStats[cpras[lead]] = variantStats[cpras[lead]]
+
+			// Variants are sorted by position, so the ones in the window
+			// of the lead variant are next to it.
+			for ii := lead; ii >= 0 && positions[lead]-positions[ii] <= windowSize; ii-- {
+				clumped[ii] = true
+			}
+			for ii := lead; ii < len(cpras) && positions[ii]-positions[lead] <= windowSize; ii++ {
+				clumped[ii] = true
+			}
+		}
+	}
+
+	return clumpedStats
+}
+
+// Missing p-values are considered the least significant.
+func clumpingPVal(multipleStats []OutputStats, clumpBy string) float64 {
+	minPVal := math.Inf(1)
+	for _, stats := range multipleStats {
+		if clumpBy != "min" && stats.Tag != clumpBy {
+			continue
+		}
+
+		pval, err := parseFloat64NaN(stats.PVal)
+		logCheck("parsing p-value as float", err)
+		if pval < minPVal {
+			minPVal = pval
+		}
+	}
+	return minPVal
+}
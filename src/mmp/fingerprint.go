@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Fingerprint is a SHA-256 identifying a run, so that pipelines can skip it
+// when nothing changed. It covers the MMP::io version, the configuration as it
+// will be run, the options and the size and modification time of the files
+// read by the run, which are not read themselves.
+func (runner *Runner) Fingerprint(conf Conf) (_ string, err error) {
+	defer runner.recoverFailure(&err)
+	runner.checkFailure()
+
+	hash := sha256.New()
+
+	fmt.Fprintf(hash, "version\t%s\n", runner.Version)
+
+	data, err := json.Marshal(effectiveConf(conf))
+	logCheck("encoding configuration", err)
+	fmt.Fprintf(hash, "config\t%s\n", data)
+
+	// The configuration path doesn't matter, only its content
+	runOptions := runner.Options
+	runOptions.Version = ""
+	runOptions.ConfigPath = ""
+	data, err = json.Marshal(runOptions)
+	logCheck("encoding options", err)
+	fmt.Fprintf(hash, "options\t%s\n", data)
+
+	for _, filePath := range runner.fingerprintFiles(conf) {
+		info, err := os.Stat(filePath)
+		logCheck("checking file for the fingerprint", err)
+		fmt.Fprintf(hash, "file\t%s\t%d\t%d\n", filePath, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Files read by the run: the data files of the inputs and their manifests,
+// the finemap files, and the files given on the command line.
+func (runner *Runner) fingerprintFiles(conf Conf) []string {
+	var filePaths []string
+	for _, inputConf := range conf.Inputs {
+		if inputConf.isManifest() {
+			filePaths = append(filePaths, strings.TrimPrefix(inputConf.Filepath, "@"))
+		}
+		filePaths = append(filePaths, inputConf.filepaths()...)
+
+		if inputConf.FinemapFilepath == "" || runner.NoFinemap {
+			continue
+		}
+		if strings.HasPrefix(inputConf.FinemapFilepath, "@") {
+			filePaths = append(filePaths, strings.TrimPrefix(inputConf.FinemapFilepath, "@"))
+		}
+		filePaths = append(filePaths, inputConf.finemapFilepaths()...)
+	}
+	for _, filePath := range []string{runner.GenesPath, runner.SelectionPath} {
+		if filePath != "" {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	return filePaths
+}
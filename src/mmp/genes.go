@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"bufio"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Gene interval with 1-based inclusive coordinates
+type GeneInterval struct {
+	Name  string
+	Start int64
+	End   int64
+}
+
+// Gene intervals of a chromosome sorted by start, with the largest end of
+// the intervals up to each index, so that the overlapping and upstream genes
+// of a position are found without going through all the genes.
+type ChromGenes struct {
+	Genes     []GeneInterval
+	prefixEnd []int64
+}
+
+// Gene intervals by chromosome, without the chr prefix so that they match
+// inputs using either chromosome naming.
+type GeneIndex map[string]*ChromGenes
+
+// Read the genes of a BED file (chrom, 0-based start, end, name) or of a GTF
+// file, based on its .gtf or .gtf.gz extension, taking the rows of the "gene"
+// feature and their gene_name or gene_id.
+func (runner *Runner) readGeneIndex(filePath string) GeneIndex {
+	isGTF := strings.HasSuffix(filePath, ".gtf") || strings.HasSuffix(filePath, ".gtf.gz")
+	compressionType := "uncompressed"
+	if strings.HasSuffix(filePath, ".gz") {
+		compressionType = "gzip"
+	}
+
+	dataReader, closeFile := runner.openDecompressed(filePath, compressionType)
+	defer closeFile()
+
+	index := make(GeneIndex)
+	scanner := bufio.NewScanner(dataReader)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		var chrom string
+		var gene GeneInterval
+		if isGTF {
+			if len(fields) < 9 {
+				fail("GTF row has ", len(fields), " fields instead of 9 in gene file `", filePath, "`: ", line)
+			}
+			if fields[2] != "gene" {
+				continue
+			}
+			chrom = fields[0]
+			gene = GeneInterval{
+				Name:  gtfGeneName(fields[8]),
+				Start: parseGenePos(fields[3], filePath),
+				End:   parseGenePos(fields[4], filePath),
+			}
+		} else {
+			if len(fields) < 4 {
+				fail("BED row has ", len(fields), " fields but needs at least 4 (chrom, start, end, name) in gene file `", filePath, "`: ", line)
+			}
+			chrom = fields[0]
+			gene = GeneInterval{
+				Name:  fields[3],
+				Start: parseGenePos(fields[1], filePath) + 1,
+				End:   parseGenePos(fields[2], filePath),
+			}
+		}
+
+		chromKey := strings.TrimPrefix(chrom, "chr")
+		chromGenes, found := index[chromKey]
+		if !found {
+			chromGenes = &ChromGenes{}
+			index[chromKey] = chromGenes
+		}
+		chromGenes.Genes = append(chromGenes.Genes, gene)
+	}
+	logCheck("reading gene file", scanner.Err())
+
+	for _, chromGenes := range index {
+		sort.SliceStable(chromGenes.Genes, func(ii, jj int) bool {
+			return chromGenes.Genes[ii].Start < chromGenes.Genes[jj].Start
+		})
+		chromGenes.prefixEnd = make([]int64, len(chromGenes.Genes))
+		for ii, gene := range chromGenes.Genes {
+			chromGenes.prefixEnd[ii] = gene.End
+			if ii > 0 && chromGenes.prefixEnd[ii-1] > gene.End {
+				chromGenes.prefixEnd[ii] = chromGenes.prefixEnd[ii-1]
+			}
+		}
+	}
+
+	return index
+}
+
+func parseGenePos(pos string, filePath string) int64 {
+	parsed, err := strconv.ParseInt(pos, 10, 64)
+	if err != nil {
+		fail("Gene position `", pos, "` is not an integer in gene file `", filePath, "`.")
+	}
+	return parsed
+}
+
+// The gene_name attribute of a GTF row, or gene_id when it has none
+func gtfGeneName(attributes string) string {
+	geneID := outputDefaultMissingValue
+	for _, attribute := range strings.Split(attributes, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(attribute), " ")
+		if !found {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "gene_name":
+			return value
+		case "gene_id":
+			geneID = value
+		}
+	}
+	return geneID
+}
+
+// Nearest gene of a 1-based position and its distance, 0 when the position
+// is inside the gene. When several genes are at the same distance, the one
+// with the largest start before the position is taken. The found return
+// value is false when there is no gene on the chromosome.
+func (index GeneIndex) nearestGene(chrom string, pos int64) (GeneInterval, int64, bool) {
+	chromGenes, found := index[strings.TrimPrefix(chrom, "chr")]
+	if !found || len(chromGenes.Genes) == 0 {
+		return GeneInterval{}, 0, false
+	}
+	genes := chromGenes.Genes
+
+	// First gene starting after the position
+	idxAfter := sort.Search(len(genes), func(ii int) bool {
+		return genes[ii].Start > pos
+	})
+
+	var nearest GeneInterval
+	distance := int64(-1)
+	if idxAfter > 0 {
+		// Some gene starting at or before the position ends after it
+		if chromGenes.prefixEnd[idxAfter-1] >= pos {
+			for ii := idxAfter - 1; ii >= 0; ii-- {
+				if genes[ii].End >= pos {
+					return genes[ii], 0, true
+				}
+			}
+		}
+
+		upstreamEnd := chromGenes.prefixEnd[idxAfter-1]
+		for ii := idxAfter - 1; ii >= 0; ii-- {
+			if genes[ii].End == upstreamEnd {
+				nearest = genes[ii]
+				break
+			}
+		}
+		distance = pos - upstreamEnd
+	}
+	if idxAfter < len(genes) {
+		downstreamDistance := genes[idxAfter].Start - pos
+		if distance == -1 || downstreamDistance < distance {
+			nearest = genes[idxAfter]
+			distance = downstreamDistance
+		}
+	}
+
+	return nearest, distance, true
+}
@@ -0,0 +1,1066 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FINNGEN/mmpio/meta"
+	"github.com/klauspost/compress/zstd"
+)
+
+type CPRA struct {
+	Chrom string
+	Pos   string
+	Ref   string
+	Alt   string
+}
+
+type SummaryStats struct {
+	PVal   string
+	Beta   string
+	SEBeta string
+	AF     string
+	PIP    string
+	CS     string
+	N      string
+
+	NCases    string
+	NControls string
+
+	// Values of the passthrough columns, in the order of the configuration
+	Passthrough []string
+
+	// Values of the annotation columns, for the inputs providing them
+	Annotations []string
+}
+
+// This is using struct embedding, see https://gobyexample.com/struct-embedding
+// It is useful like this because in some places we need the CPRA struct without
+// the stats attached.
+type InputSummaryStatsRow struct {
+	Tag string
+	CPRA
+	SummaryStats
+}
+
+type InputFinemapRow struct {
+	Tag string
+	CPRA
+	PIP string
+	CS  string
+}
+
+type OutputStats struct {
+	Tag    string
+	PVal   string
+	Beta   string
+	SEBeta string
+	AF     string
+	PIP    string
+	CS     string
+	N      string
+
+	NCases    string
+	NControls string
+
+	// Values of the passthrough columns, in the order of the configuration
+	Passthrough []string
+
+	// Values of the annotation columns, for the inputs providing them
+	Annotations []string
+
+	// Alleles as reported by the input, which differ from the ones of the
+	// variant when the stats were aligned on a reference input.
+	InputRef string
+	InputAlt string
+}
+
+// A variant passing the selection of an input, significant when it passes
+// the p-value threshold and suggestive when it only passes the suggestive one.
+type SelectedCPRA struct {
+	CPRA
+	Significant bool
+	PVal        float64
+}
+
+func (runner *Runner) streamVariantsAboveThreshold(inputConf InputConf, cpraChannel chan<- SelectedCPRA) {
+	fmt.Printf("- processing %s\n", inputConf.Tag)
+
+	pvalThreshold := float64(inputConf.PValThreshold)
+	if inputConf.Selection == "bonferroni" || inputConf.Selection == "fdr" {
+		pvalThreshold = runner.dataSelectionThreshold(inputConf)
+		fmt.Printf("- %s threshold of %s at alpha %g: %g\n", inputConf.Selection, inputConf.Tag, inputConf.Alpha, pvalThreshold)
+	}
+
+	parsedRowChannel := make(chan InputSummaryStatsRow)
+	go func() {
+		defer close(parsedRowChannel)
+		defer runner.recoverRoutine()
+		runner.streamSummaryStatsFile(inputConf, parsedRowChannel, false)
+	}()
+
+	var pvals *pvalSummary
+	if runner.ReportPath != "" {
+		pvals = newPValSummary()
+	}
+
+	for row := range parsedRowChannel {
+		parsedPVal, err := parseFloat64NaN(row.PVal)
+		logCheck("parsing p-value as float", err)
+
+		if pvals != nil {
+			pvals.add(parsedPVal)
+		}
+
+		if parsedPVal < pvalThreshold {
+			if !send(runner, cpraChannel, SelectedCPRA{CPRA: row.CPRA, Significant: true, PVal: parsedPVal}) {
+				return
+			}
+		} else if parsedPVal < float64(inputConf.SuggestiveThreshold) {
+			if !send(runner, cpraChannel, SelectedCPRA{CPRA: row.CPRA, Significant: false, PVal: parsedPVal}) {
+				return
+			}
+		} else if math.IsNaN(parsedPVal) {
+			runner.reportRejected(inputConf.Tag, row.CPRA, rejectedMissingPVal)
+		} else {
+			runner.reportRejected(inputConf.Tag, row.CPRA, rejectedBelowThreshold)
+		}
+	}
+
+	if pvals != nil {
+		runner.reportInputPVals(inputConf.Tag, pvals)
+	}
+
+	fmt.Printf("* done %s\n", inputConf.Tag)
+}
+
+// Only keep the maxCount selected variants with the smallest p-values. Ties
+// are broken by the variant order, so that the kept variants are the same
+// across runs, and so that the most significant variants across inputs are
+// always among the most significant ones of some input.
+func keepMostSignificant(selectedVariants map[CPRA]bool, minPVals map[CPRA]float64, maxCount int64) {
+	if int64(len(minPVals)) <= maxCount {
+		return
+	}
+
+	cpras := make([]CPRA, 0, len(minPVals))
+	for cpra := range minPVals {
+		cpras = append(cpras, cpra)
+	}
+	sortCPRAs(cpras)
+	sort.SliceStable(cpras, func(ii, jj int) bool {
+		return minPVals[cpras[ii]] < minPVals[cpras[jj]]
+	})
+
+	for _, cpra := range cpras[maxCount:] {
+		delete(selectedVariants, cpra)
+		delete(minPVals, cpra)
+	}
+}
+
+// The Bonferroni and Benjamini-Hochberg thresholds depend on the number of
+// tested variants, so the input is read once more before the selection.
+// Variants dropped by the filters or with a missing p-value are not counted.
+func (runner *Runner) dataSelectionThreshold(inputConf InputConf) float64 {
+	parsedRowChannel := make(chan InputSummaryStatsRow)
+	go func() {
+		defer close(parsedRowChannel)
+		defer runner.recoverRoutine()
+		runner.streamSummaryStatsFile(inputConf, parsedRowChannel, false)
+	}()
+
+	var pvals []float64
+	for row := range parsedRowChannel {
+		parsedPVal, err := parseFloat64NaN(row.PVal)
+		logCheck("parsing p-value as float", err)
+		if !math.IsNaN(parsedPVal) {
+			pvals = append(pvals, parsedPVal)
+		}
+	}
+	if len(pvals) == 0 {
+		return 0
+	}
+
+	nTests := float64(len(pvals))
+	if inputConf.Selection == "bonferroni" {
+		return inputConf.Alpha / nTests
+	}
+
+	// Benjamini-Hochberg: the largest p-value p_(k) with p_(k) <= k/m * alpha
+	// and all the smaller p-values are selected. The threshold is just above
+	// it since the selection keeps the p-values strictly below the threshold.
+	sort.Float64s(pvals)
+	for kk := len(pvals); kk > 0; kk-- {
+		if pvals[kk-1] <= float64(kk)/nTests*inputConf.Alpha {
+			return math.Nextafter(pvals[kk-1], math.Inf(1))
+		}
+	}
+	return 0
+}
+
+func (runner *Runner) streamRowsFromSelection(inputConf InputConf, selectedVariants map[CPRA]bool, selectedRowChannel chan<- InputSummaryStatsRow) {
+	fmt.Printf("- processing %s\n", inputConf.Tag)
+
+	parsedRowChannel := make(chan InputSummaryStatsRow)
+	go func() {
+		defer close(parsedRowChannel)
+		defer runner.recoverRoutine()
+		runner.streamSummaryStatsFile(inputConf, parsedRowChannel, true)
+	}()
+
+	for row := range parsedRowChannel {
+		if _, found := selectedVariants[row.CPRA]; found && !send(runner, selectedRowChannel, row) {
+			return
+		}
+	}
+
+	fmt.Printf("* done %s\n", inputConf.Tag)
+}
+
+// The rows dropped by the filters are reported to the rejected variants log
+// only if reportFiltered is set, so that they are not reported twice as the
+// summary stats files are read once for the selection and once for the stats.
+func (runner *Runner) streamSummaryStatsFile(inputConf InputConf, parsedRowChannel chan<- InputSummaryStatsRow, reportFiltered bool) {
+	fileRowChannel := make(chan []string)
+
+	// Without a sebeta column, the -log10(p) column takes its place and sebeta
+	// is derived from it.
+	seBetaColumn := inputConf.ColSEBeta
+	if seBetaColumn == "" {
+		seBetaColumn = inputConf.ColNegLog10P
+	}
+	// With a single alleles column, it is read in place of both the ref and
+	// alt columns and split afterwards.
+	refColumn := inputConf.ColRef
+	altColumn := inputConf.ColAlt
+	if inputConf.ColAlleles != "" {
+		refColumn = inputConf.ColAlleles
+		altColumn = inputConf.ColAlleles
+	}
+	requestedColumns := []string{
+		inputConf.ColChrom,
+		inputConf.ColPos,
+		refColumn,
+		altColumn,
+		inputConf.ColPVal[0],
+		inputConf.ColBeta,
+		seBetaColumn,
+		inputConf.ColAF,
+	}
+
+	// Optional columns are appended after the required ones,
+	// we keep track of where they are in the parsed rows.
+	idxExtraPVals := len(requestedColumns)
+	requestedColumns = append(requestedColumns, inputConf.ColPVal[1:]...)
+	idxEffectAllele := -1
+	if inputConf.ColEffectAllele != "" {
+		idxEffectAllele = len(requestedColumns)
+		requestedColumns = append(requestedColumns, inputConf.ColEffectAllele)
+	}
+	idxPIP := -1
+	idxCS := -1
+	if inputConf.ColPIP != "" {
+		idxPIP = len(requestedColumns)
+		idxCS = idxPIP + 1
+		requestedColumns = append(requestedColumns, inputConf.ColPIP, inputConf.ColCS)
+	}
+	idxN := -1
+	if inputConf.ColN != "" {
+		idxN = len(requestedColumns)
+		requestedColumns = append(requestedColumns, inputConf.ColN)
+	}
+	idxInfo := -1
+	if inputConf.ColInfo != "" {
+		idxInfo = len(requestedColumns)
+		requestedColumns = append(requestedColumns, inputConf.ColInfo)
+	}
+	idxNCases := -1
+	idxNControls := -1
+	if inputConf.ColNCases != "" {
+		idxNCases = len(requestedColumns)
+		idxNControls = idxNCases + 1
+		requestedColumns = append(requestedColumns, inputConf.ColNCases, inputConf.ColNControls)
+	}
+	idxPassthrough := len(requestedColumns)
+	requestedColumns = append(requestedColumns, inputConf.PassthroughColumns...)
+	idxAnnotations := len(requestedColumns)
+	requestedColumns = append(requestedColumns, inputConf.annotationColumns...)
+
+	go func() {
+		defer close(fileRowChannel)
+		defer runner.recoverRoutine()
+		runner.streamInputFiles(inputConf, requestedColumns, fileRowChannel)
+	}()
+
+	rowChannel := fileRowChannel
+	if inputConf.SplitMultiallelic {
+		// The p-values, beta, sebeta and af have a value per alt allele,
+		// the other columns, such as the passthrough ones, are kept as is.
+		perAlleleIndices := []int{4, 5, 6, 7}
+		for ii := range inputConf.ColPVal[1:] {
+			perAlleleIndices = append(perAlleleIndices, idxExtraPVals+ii)
+		}
+		splitRowChannel := make(chan []string)
+		go func(rowChannel <-chan []string) {
+			defer close(splitRowChannel)
+			defer runner.recoverRoutine()
+			runner.splitMultiallelicRows(rowChannel, splitRowChannel, perAlleleIndices)
+		}(rowChannel)
+		rowChannel = splitRowChannel
+	}
+
+	nInvalidAF := 0
+	nInvalidMAF := 0
+	nInvalidPVal := 0
+	nZeroBeta := 0
+	nNonAutosomal := 0
+
+	for row := range rowChannel {
+		if inputConf.ColAlleles != "" {
+			row[2], row[3] = splitAlleles(row[2], inputConf)
+		}
+
+		// Missing values of the input are replaced by ours before parsing.
+		// The variant fields and the passthrough fields are kept as they are.
+		if len(inputConf.NATokens) > 0 {
+			for ii := 4; ii < idxPassthrough; ii++ {
+				if contains(inputConf.NATokens, row[ii]) {
+					row[ii] = outputDefaultMissingValue
+				}
+			}
+		}
+
+		chrom := row[0]
+		pos := row[1]
+		ref := row[2]
+		alt := row[3]
+
+		if !inputConf.keepContig(chrom) {
+			if reportFiltered {
+				runner.reportRejected(inputConf.Tag, CPRA{chrom, pos, ref, alt}, rejectedContigFilter)
+			}
+			continue
+		}
+		if inputConf.AutosomesOnly && !isAutosome(chrom) {
+			nNonAutosomal++
+			if reportFiltered {
+				runner.reportRejected(inputConf.Tag, CPRA{chrom, pos, ref, alt}, rejectedContigFilter)
+			}
+			continue
+		}
+		// Positions are 1-based in the output, so that they match across inputs
+		if inputConf.positionBase() == 0 {
+			pos = oneBasedPosition(pos)
+		}
+
+		pval := row[4]
+		extraPVals := row[idxExtraPVals : idxExtraPVals+len(inputConf.ColPVal)-1]
+		if inputConf.PValIsNegLog10 {
+			pval = pvalFromNegLog10(pval)
+			for ii, extraPVal := range extraPVals {
+				extraPVals[ii] = pvalFromNegLog10(extraPVal)
+			}
+		}
+		pval = minPVal(pval, extraPVals)
+		if validPVal, isValid := validatePVal(pval); !isValid {
+			nInvalidPVal++
+			switch inputConf.InvalidPVal {
+			case "skip":
+				if reportFiltered {
+					runner.reportRejected(inputConf.Tag, CPRA{chrom, pos, ref, alt}, rejectedInvalidPVal)
+				}
+				continue
+			case "fail":
+				fail("P-value `", pval, "` is outside of [0, 1] for variant ", chrom, ":", pos, ":", ref, ":", alt, " in input `", inputConf.Tag, "`.")
+			default:
+				pval = validPVal
+			}
+		}
+		beta := row[5]
+		seBeta := row[6]
+		af := row[7]
+		if inputConf.ColSEBeta == "" {
+			var zeroBeta bool
+			seBeta, zeroBeta = seBetaFromNegLog10P(beta, seBeta)
+			if zeroBeta {
+				nZeroBeta++
+			}
+		}
+
+		// Manual harmonization of inputs with a known inverted convention
+		if inputConf.FlipBeta {
+			beta = flipSign(beta)
+		}
+		if inputConf.EffectScaleFactor != 0 {
+			beta = scaleEffect(beta, inputConf.EffectScaleFactor)
+			seBeta = scaleEffect(seBeta, inputConf.EffectScaleFactor)
+		}
+
+		parsedAF, err := parseFloat64NaN(af)
+		logCheck("parsing AF as float", err)
+		if inputConf.AFScale == "percent" && !math.IsNaN(parsedAF) {
+			parsedAF /= 100
+			af = formatFloat(parsedAF)
+		}
+		if inputConf.FlipAF && !math.IsNaN(parsedAF) {
+			parsedAF = 1 - parsedAF
+			af = formatFloat(parsedAF)
+		}
+		if parsedAF < 0 || parsedAF > 1 {
+			nInvalidAF++
+		} else if inputConf.AFIsMAF && parsedAF > 0.5 {
+			nInvalidMAF++
+		}
+		if !inputConf.keepAF(parsedAF) {
+			if reportFiltered {
+				runner.reportRejected(inputConf.Tag, CPRA{chrom, pos, ref, alt}, rejectedAFFilter)
+			}
+			continue
+		}
+
+		// Drop poorly imputed variants
+		if idxInfo != -1 {
+			info, err := parseFloat64NaN(row[idxInfo])
+			logCheck("parsing INFO as float", err)
+			if info < inputConf.InfoThreshold {
+				if reportFiltered {
+					runner.reportRejected(inputConf.Tag, CPRA{chrom, pos, ref, alt}, rejectedInfoFilter)
+				}
+				continue
+			}
+		}
+
+		// Our convention is that beta is the effect of the alt allele,
+		// so we flip it when the input reports the effect of the ref allele.
+		if idxEffectAllele != -1 {
+			effectAllele := row[idxEffectAllele]
+			switch effectAllele {
+			case alt:
+			case ref:
+				beta = flipSign(beta)
+			default:
+				fail("Effect allele `", effectAllele, "` is neither ref nor alt for variant ", chrom, ":", pos, ":", ref, ":", alt, " in input `", inputConf.Tag, "`.")
+			}
+		}
+
+		// Finemapping values are missing unless they are in the same file as
+		// the summary stats. When they are in a separate finemap file they will
+		// be added later on.
+		pip := outputDefaultMissingValue
+		cs := outputDefaultMissingValue
+		if idxPIP != -1 {
+			pip = row[idxPIP]
+			cs = row[idxCS]
+		}
+
+		n := outputDefaultMissingValue
+		nCases := outputDefaultMissingValue
+		nControls := outputDefaultMissingValue
+		if idxN != -1 {
+			n = row[idxN]
+		}
+		if idxNCases != -1 {
+			nCases = row[idxNCases]
+			nControls = row[idxNControls]
+			n = parseEffectiveSampleSize(nCases, nControls)
+		}
+
+		parsedRow := InputSummaryStatsRow{
+			Tag:  inputConf.Tag,
+			CPRA: CPRA{chrom, pos, ref, alt},
+			SummaryStats: SummaryStats{
+				PVal:   pval,
+				Beta:   beta,
+				SEBeta: seBeta,
+				AF:     af,
+				PIP:    pip,
+				CS:     cs,
+				N:      n,
+
+				NCases:    nCases,
+				NControls: nControls,
+
+				Passthrough: row[idxPassthrough : idxPassthrough+len(inputConf.PassthroughColumns)],
+				Annotations: row[idxAnnotations : idxAnnotations+len(inputConf.annotationColumns)],
+			},
+		}
+
+		if !send(runner, parsedRowChannel, parsedRow) {
+			return
+		}
+	}
+
+	// Printed once, when reading the stats, as the inputs are read more than once
+	if inputConf.AutosomesOnly && reportFiltered {
+		fmt.Printf("- dropped %d variants outside of the autosomes from %s\n", nNonAutosomal, inputConf.Tag)
+	}
+	if nZeroBeta > 0 {
+		log.Printf("WARNING: %d variants have a beta of 0 in input `%s`, their sebeta cannot be derived from the -log10 p-value and is missing.", nZeroBeta, inputConf.Tag)
+	}
+	if nInvalidPVal > 0 {
+		action := "clamped to [0, 1]"
+		if inputConf.InvalidPVal == "skip" {
+			action = "skipped"
+		}
+		log.Printf("WARNING: %d variants have a p-value outside of [0, 1] in input `%s`, they were %s.", nInvalidPVal, inputConf.Tag, action)
+	}
+	if nInvalidAF > 0 {
+		hint := ""
+		if inputConf.AFScale != "percent" {
+			hint = " Use `\"af_scale\": \"percent\"` if its AF are percentages."
+		}
+		log.Printf("WARNING: %d variants have an AF outside of [0, 1] in input `%s`.%s", nInvalidAF, inputConf.Tag, hint)
+	}
+	if nInvalidMAF > 0 {
+		log.Printf("WARNING: %d variants have an AF above 0.5 in input `%s`, which has `af_is_maf`.", nInvalidMAF, inputConf.Tag)
+	}
+}
+
+// The data files of an input given as a manifest are streamed one after the
+// other, as a single input.
+func (runner *Runner) streamInputFiles(inputConf InputConf, columns []string, rowChannel chan<- []string) {
+	for _, dataFilepath := range inputConf.filepaths() {
+		if runner.isStopped() {
+			return
+		}
+		runner.streamInputFile(inputConf, dataFilepath, columns, rowChannel)
+	}
+}
+
+func (runner *Runner) streamInputFile(inputConf InputConf, dataFilepath string, columns []string, rowChannel chan<- []string) {
+	if inputConf.Format == "vcf" {
+		runner.streamVcf(dataFilepath, inputConf.compression(dataFilepath), columns, rowChannel)
+	} else {
+		runner.streamTsv(dataFilepath, inputConf.compression(dataFilepath), inputConf.hasHeader(), inputConf.TrimSpaces, columns, rowChannel)
+	}
+}
+
+// Check that the data files listed in the manifest of an input exist and, for
+// files with a header, that they all have the same header. This way a
+// mistake in the last file doesn't stop MMP::io after processing the others.
+func (runner *Runner) validateManifestFiles(inputConf InputConf) {
+	var firstHeader []string
+	for _, dataFilepath := range inputConf.filepaths() {
+		_, err := os.Stat(dataFilepath)
+		logCheck("checking data file of manifest", err)
+
+		if inputConf.Format == "vcf" || !inputConf.hasHeader() {
+			continue
+		}
+
+		_, header, closeTsv := runner.openTsv(dataFilepath, inputConf.compression(dataFilepath))
+		closeTsv()
+		if firstHeader == nil {
+			firstHeader = header
+		} else if strings.Join(header, "\t") != strings.Join(firstHeader, "\t") {
+			fail("Data file `", dataFilepath, "` of input `", inputConf.Tag, "` doesn't have the same header as the first data file of its manifest. Header: ", header)
+		}
+	}
+}
+
+// Split rows having a comma-separated list of alt alleles into one row per alt allele.
+// The values at perAlleleIndices that are comma-separated lists with one value per
+// alt allele (for example beta and af) are split too, the other values are duplicated.
+func (runner *Runner) splitMultiallelicRows(rowChannel <-chan []string, splitRowChannel chan<- []string, perAlleleIndices []int) {
+	const idxAlt = 3
+
+	for row := range rowChannel {
+		alts := strings.Split(row[idxAlt], ",")
+		if len(alts) == 1 {
+			if !send(runner, splitRowChannel, row) {
+				return
+			}
+			continue
+		}
+
+		for ii, alt := range alts {
+			splitRow := make([]string, len(row))
+			copy(splitRow, row)
+			for _, jj := range perAlleleIndices {
+				splitValue := strings.Split(row[jj], ",")
+				if len(splitValue) == len(alts) {
+					splitRow[jj] = splitValue[ii]
+				}
+			}
+			splitRow[idxAlt] = alt
+
+			if !send(runner, splitRowChannel, splitRow) {
+				return
+			}
+		}
+	}
+}
+
+// Split the alleles column of an input into the ref and alt alleles, the
+// first allele being the ref unless the input has alleles_alt_first.
+func splitAlleles(alleles string, inputConf InputConf) (string, string) {
+	parts := strings.Split(alleles, inputConf.allelesSeparator())
+	if len(parts) != 2 {
+		fail("Alleles `", alleles, "` of input `", inputConf.Tag, "` should be 2 alleles separated by `", inputConf.allelesSeparator(), "`.")
+	}
+	if inputConf.AllelesAltFirst {
+		return parts[1], parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+func oneBasedPosition(pos string) string {
+	return strconv.FormatInt(parsePos(pos)+1, 10)
+}
+
+// P-values slightly outside of [0, 1], such as -0.0 or 1.0000001, come from
+// rounding in the tool that wrote the input. Returns whether the p-value is
+// valid, and otherwise the p-value clamped to [0, 1].
+func validatePVal(pval string) (string, bool) {
+	parsedPVal, err := parseFloat64NaN(pval)
+	logCheck("parsing p-value as float", err)
+	if math.IsNaN(parsedPVal) {
+		return pval, true
+	}
+	if math.Signbit(parsedPVal) {
+		return "0", false
+	}
+	if parsedPVal > 1 {
+		return "1", false
+	}
+	return pval, true
+}
+
+// When multiple p-value columns are given, the selection and the output use
+// the smallest one. Missing values are ignored.
+func minPVal(pval string, extraPVals []string) string {
+	if len(extraPVals) == 0 {
+		return pval
+	}
+
+	chosenPVal := pval
+	parsedChosenPVal, err := parseFloat64NaN(pval)
+	logCheck("parsing p-value as float", err)
+
+	for _, extraPVal := range extraPVals {
+		parsedExtraPVal, err := parseFloat64NaN(extraPVal)
+		logCheck("parsing p-value as float", err)
+
+		if math.IsNaN(parsedChosenPVal) || parsedExtraPVal < parsedChosenPVal {
+			chosenPVal = extraPVal
+			parsedChosenPVal = parsedExtraPVal
+		}
+	}
+
+	return chosenPVal
+}
+
+// Bring the effects of an input to the scale of the other inputs
+func scaleEffect(value string, factor float64) string {
+	parsedValue, err := parseFloat64NaN(value)
+	logCheck("parsing effect as float", err)
+
+	if math.IsNaN(parsedValue) {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(parsedValue * factor)
+}
+
+// Some tools, for example REGENIE with LOG10P, report -log10(p) instead of p.
+// The p-value is smaller than the smallest float64 for -log10(p) above ~323,
+// it is then reported as 0.
+func pvalFromNegLog10(negLog10P string) string {
+	parsedNegLog10P, err := parseFloat64NaN(negLog10P)
+	logCheck("parsing -log10(p) as float", err)
+
+	if math.IsNaN(parsedNegLog10P) {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(math.Pow(10, -parsedNegLog10P))
+}
+
+// The z-score of the -log10 p-value gives sebeta = |beta| / |z|. It is
+// undefined when beta is 0, which is then reported by the second return value.
+func seBetaFromNegLog10P(beta string, negLog10P string) (string, bool) {
+	if beta == "NA" || negLog10P == "NA" {
+		return outputDefaultMissingValue, false
+	}
+
+	parsedBeta, err := parseFloat64NaN(beta)
+	logCheck("parsing beta as float", err)
+	parsedNegLog10P, err := parseFloat64NaN(negLog10P)
+	logCheck("parsing -log10(p) as float", err)
+
+	if parsedBeta == 0 {
+		return outputDefaultMissingValue, true
+	}
+	z := meta.NormalZ(parsedNegLog10P)
+	if z == 0 {
+		return outputDefaultMissingValue, false
+	}
+
+	return formatFloat(math.Abs(parsedBeta) / z), false
+}
+
+func parseEffectiveSampleSize(nCases string, nControls string) string {
+	parsedNCases, err := parseFloat64NaN(nCases)
+	logCheck("parsing number of cases as float", err)
+
+	parsedNControls, err := parseFloat64NaN(nControls)
+	logCheck("parsing number of controls as float", err)
+
+	nEff := meta.EffectiveSampleSize(parsedNCases, parsedNControls)
+	if math.IsNaN(nEff) {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(nEff)
+}
+
+func (runner *Runner) streamFinemapFile(inputConf InputConf, parsedRowChannel chan<- InputFinemapRow) {
+	fmt.Printf("- processing %s\n", inputConf.Tag)
+
+	// The finemap files of a manifest are read one after the other
+	for _, finemapFilepath := range inputConf.finemapFilepaths() {
+		rowChannel := make(chan []string)
+		go func(finemapFilepath string) {
+			defer close(rowChannel)
+			defer runner.recoverRoutine()
+			runner.streamTsv(finemapFilepath, "uncompressed", true, false, finemapColumns, rowChannel)
+		}(finemapFilepath)
+
+		for row := range rowChannel {
+			cpra := row[0]
+			pip := row[1]
+			cs := row[2]
+
+			parsedRow := InputFinemapRow{
+				Tag:  inputConf.Tag,
+				CPRA: parseFinemapCPRA(cpra, inputConf.finemapCPRASeparator()),
+				PIP:  pip,
+				CS:   cs,
+			}
+
+			if !send(runner, parsedRowChannel, parsedRow) {
+				return
+			}
+		}
+	}
+
+	fmt.Printf("* done %s\n", inputConf.Tag)
+}
+
+// Columns of the finemap files: variant, PIP and credible set.
+var finemapColumns = []string{"v", "cs_specific_prob", "cs"}
+
+// Parse the CPRA from assumed "C:P:R:A" format, with a configurable separator
+func parseFinemapCPRA(cpra string, separator string) CPRA {
+	splitCPRA := strings.Split(cpra, separator)
+	if len(splitCPRA) != 4 {
+		fail("Could not parse CPRA from value `", cpra, "` using separator `", separator, "`.")
+	}
+	chrom := splitCPRA[0]
+	pos := splitCPRA[1]
+	ref := splitCPRA[2]
+	alt := splitCPRA[3]
+
+	return CPRA{chrom, pos, ref, alt}
+}
+
+// Check the columns and the variant format of the first data row of the
+// finemap files, so that mistakes are reported before processing all the
+// summary stats. The finemap files of a manifest must all have the same header.
+func (runner *Runner) validateFinemapFiles(inputConf InputConf) {
+	var firstHeader []string
+	for _, finemapFilepath := range inputConf.finemapFilepaths() {
+		header := runner.validateFinemapFile(inputConf, finemapFilepath)
+		if firstHeader == nil {
+			firstHeader = header
+		} else if strings.Join(header, "\t") != strings.Join(firstHeader, "\t") {
+			fail("Finemap file `", finemapFilepath, "` of input `", inputConf.Tag, "` doesn't have the same header as the first finemap file of its manifest. Header: ", header)
+		}
+	}
+}
+
+func (runner *Runner) validateFinemapFile(inputConf InputConf, finemapFilepath string) []string {
+	tsvReader, header, closeTsv := runner.openTsv(finemapFilepath, "uncompressed")
+	defer closeTsv()
+
+	requestedColIndices := requestedColumnIndices(header, finemapColumns, finemapFilepath)
+
+	row, err := tsvReader.Read()
+	if err == io.EOF {
+		return header
+	}
+	logCheck("parsing TSV row", err)
+
+	parseFinemapCPRA(row[requestedColIndices[0]], inputConf.finemapCPRASeparator())
+	return header
+}
+
+// Open a file for reading, uncompressing it if necessary.
+// The returned function closes the file.
+func (runner *Runner) openDecompressed(filepath string, compressionType string) (io.Reader, func()) {
+	// Open file for reading
+	fReader, err := os.Open(filepath)
+	logCheck("opening file", err)
+
+	openReader := func(compressedReader io.Reader) (io.Reader, func()) {
+		return decompressedReader(filepath, compressedReader, compressionType, fReader)
+	}
+	if runner.ProgressInterval > 0 {
+		return runner.trackProgress(filepath, compressionType, fReader, openReader)
+	}
+	return openReader(fReader)
+}
+
+// The compression of a data file is given by its extension: .gz for gzip, .bz2
+// for bzip2, .zst for zstd, and .tsv or .txt for uncompressed. Other extensions
+// fall back to the gzip magic number at the start of the file, which also
+// catches gzip files with a .tsv or .txt extension.
+func detectCompression(dataFilepath string) string {
+	switch filepath.Ext(dataFilepath) {
+	case ".gz":
+		return "gzip"
+	case ".bz2":
+		return "bz2"
+	case ".zst":
+		return "zstd"
+	}
+
+	fReader, err := os.Open(dataFilepath)
+	logCheck("opening file", err)
+	defer fReader.Close()
+
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(fReader, magic); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return "gzip"
+	}
+	return "uncompressed"
+}
+
+// Uncompress the file if necessary
+func decompressedReader(filepath string, compressedReader io.Reader, compressionType string, fReader *os.File) (io.Reader, func()) {
+	var dataReader io.Reader
+	closeFile := func() {
+		fReader.Close()
+	}
+
+	switch compressionType {
+	case "uncompressed":
+		dataReader = compressedReader
+
+	case "gzip":
+		// Buffered so that the gzip reader doesn't read past the end of a
+		// member, and the next member starts where it stopped.
+		source := bufio.NewReader(compressedReader)
+		gzReader, err := gzip.NewReader(source)
+		logCheck("gunzip-ing file", err)
+		gzReader.Multistream(false)
+		dataReader = &gzipMembersReader{filepath: filepath, source: source, gzReader: gzReader}
+		closeFile = func() {
+			gzReader.Close()
+			fReader.Close()
+		}
+
+	case "bz2":
+		dataReader = bzip2.NewReader(compressedReader)
+
+	case "zstd":
+		zstdReader, err := zstd.NewReader(compressedReader)
+		logCheck("unzstd-ing file", err)
+		dataReader = zstdReader
+		closeFile = func() {
+			zstdReader.Close()
+			fReader.Close()
+		}
+
+	default:
+		fail("Unrecognized compression type `", compressionType, "`. Possible values are: uncompressed, gzip, bz2, zstd.")
+	}
+
+	return dataReader, closeFile
+}
+
+// Reads the members of a gzip file one after the other, as gzip does. Bytes
+// after the last member that are not a gzip member, such as the padding left
+// by a botched concatenation, end the data with a warning instead of failing
+// the run. A truncated or corrupted member stops MMP::io with the number of
+// lines read before it, to assess how much of the file is usable.
+type gzipMembersReader struct {
+	filepath string
+	source   *bufio.Reader
+	gzReader *gzip.Reader
+	nLines   int64
+	ended    bool
+}
+
+func (members *gzipMembersReader) Read(buffer []byte) (int, error) {
+	if members.ended {
+		return 0, io.EOF
+	}
+
+	nRead, err := members.gzReader.Read(buffer)
+	members.nLines += int64(bytes.Count(buffer[:nRead], []byte{'\n'}))
+	if err == io.EOF {
+		err = members.gzReader.Reset(members.source)
+		if err == nil {
+			members.gzReader.Multistream(false)
+			return nRead, nil
+		}
+
+		members.ended = true
+		if err != io.EOF {
+			log.Printf("WARNING: ignoring the trailing bytes after the last gzip member of `%s`, which are not gzip data (%v). %d lines were read before them.", members.filepath, err, members.nLines)
+		}
+		return nRead, io.EOF
+	}
+	if err != nil {
+		failf("Could not read the gzip file `%s` after %d lines, it is truncated or corrupted: %v", members.filepath, members.nLines, err)
+	}
+	return nRead, nil
+}
+
+// Open a TSV file and read its header.
+// The returned function closes the file.
+func (runner *Runner) openTsv(filepath string, compressionType string) (*csv.Reader, []string, func()) {
+	dataReader, closeFile := runner.openDecompressed(filepath, compressionType)
+
+	// Parse as TSV
+	tsvReader := csv.NewReader(dataReader)
+	tsvReader.Comma = '\t'
+
+	// Keep track of the TSV header
+	header, err := tsvReader.Read()
+	logCheck("parsing TSV header", err)
+	header = trimFields(header)
+
+	return tsvReader, header, closeFile
+}
+
+// Files edited on Windows can have a UTF-8 byte order mark at the start of
+// the file and carriage returns at the end of the fields, which would prevent
+// matching the column names.
+func trimFields(fields []string) []string {
+	if len(fields) > 0 {
+		fields[0] = strings.TrimPrefix(fields[0], "\ufeff")
+	}
+	for ii, field := range fields {
+		fields[ii] = strings.TrimSuffix(field, "\r")
+	}
+	return fields
+}
+
+// Derive the field indices we want from the header
+func requestedColumnIndices(header []string, columns []string, filepath string) []int {
+	headerToIndex := make(map[string]int)
+	for ii, headerColumn := range header {
+		headerToIndex[headerColumn] = ii
+	}
+
+	requestedColIndices := make([]int, len(columns))
+	for ii, requestedColumn := range columns {
+		headerColumnIndex, found := headerToIndex[requestedColumn]
+		if found {
+			requestedColIndices[ii] = headerColumnIndex
+		} else {
+			fail("Could not find column `", requestedColumn, "` in header of input file `", filepath, "`. Header: ", header)
+		}
+	}
+
+	return requestedColIndices
+}
+
+// Derive the field indices we want from the 1-based column positions of a
+// headerless file, checking them against the number of fields of its first row.
+func positionalColumnIndices(firstRow []string, columns []string, filepath string) []int {
+	requestedColIndices := make([]int, len(columns))
+	for ii, requestedColumn := range columns {
+		position, err := strconv.Atoi(requestedColumn)
+		if err != nil {
+			fail("Column `", requestedColumn, "` of headerless input file `", filepath, "` is not a column position. Columns of files without a header are given as 1-based positions, for example \"1\".")
+		}
+		if position < 1 || position > len(firstRow) {
+			fail("Column position `", requestedColumn, "` is out of range for headerless input file `", filepath, "`, which has ", len(firstRow), " columns on its first row.")
+		}
+		requestedColIndices[ii] = position - 1
+	}
+
+	return requestedColIndices
+}
+
+func (runner *Runner) streamTsv(filepath string, compressionType string, hasHeader bool, trimSpaces bool, columns []string, rowChannel chan<- []string) {
+	var tsvReader *csv.Reader
+	var requestedColIndices []int
+	var firstRow []string
+
+	if hasHeader {
+		var header []string
+		var closeTsv func()
+		tsvReader, header, closeTsv = runner.openTsv(filepath, compressionType)
+		defer closeTsv()
+
+		requestedColIndices = requestedColumnIndices(header, columns, filepath)
+	} else {
+		dataReader, closeFile := runner.openDecompressed(filepath, compressionType)
+		defer closeFile()
+
+		tsvReader = csv.NewReader(dataReader)
+		tsvReader.Comma = '\t'
+
+		// The first row is data, it is kept to be emitted first
+		var err error
+		firstRow, err = tsvReader.Read()
+		if err == io.EOF {
+			return
+		}
+		logCheck("parsing TSV row", err)
+		firstRow = trimFields(firstRow)
+
+		requestedColIndices = positionalColumnIndices(firstRow, columns, filepath)
+	}
+
+	// Emit the rows over the channel, up to --head rows
+	var nRows int64
+	for ; runner.HeadRows == 0 || nRows < runner.HeadRows; nRows++ {
+		runner.readersMemory.wait(nRows)
+
+		var row []string
+		var err error
+		if firstRow != nil {
+			row = firstRow
+			firstRow = nil
+		} else {
+			row, err = tsvReader.Read()
+		}
+
+		// Can't read more data if end of file or parsing error
+		if err == io.EOF {
+			break
+		}
+		logCheck("parsing TSV row", err)
+
+		// This variable needs to be initialized *inside* the for loop.
+		// If it is assigned outside (in the hope of getting some performance improvements?),
+		// then the slice will be concurrently read and written, causing bad data parsing down the line.
+		// This was also caught by the go data race detector.
+		rowFromColumns := make([]string, len(columns))
+		for ii, requestedColIndex := range requestedColIndices {
+			rowFromColumns[ii] = strings.TrimSuffix(row[requestedColIndex], "\r")
+			if trimSpaces {
+				rowFromColumns[ii] = strings.TrimSpace(rowFromColumns[ii])
+			}
+		}
+
+		if !send(runner, rowChannel, rowFromColumns) {
+			return
+		}
+	}
+}
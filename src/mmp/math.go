@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+// For heterogeneity test
+type OutputMetaStats struct {
+	Beta    string
+	SEBeta  string
+	PVal    string
+	HetPVal string
+	I2      string
+	HetFlag string
+	Q       string
+	DF      string
+
+	NegLog10PVal string
+}
+
+// String-formatted version of the result of meta.ComputeMeta, used for the output.
+// The heterogeneity flag is set when I² is above i2FlagThreshold.
+// The results that could not be computed, for example without a valid sebeta
+// or with a covariance of the studies that is not positive definite, are
+// missing, and so is the flag when I² is.
+func formatMetaResult(metaResult meta.MetaResult, i2FlagThreshold float64) OutputMetaStats {
+	hetFlag := "0"
+	if math.IsNaN(metaResult.I2) {
+		hetFlag = outputDefaultMissingValue
+	} else if metaResult.I2 > i2FlagThreshold {
+		hetFlag = "1"
+	}
+
+	// Convert values to string for outputting and return
+	return OutputMetaStats{
+		Beta:         formatMetaValue(metaResult.Beta),
+		SEBeta:       formatMetaValue(metaResult.SEBeta),
+		PVal:         formatMetaValue(metaResult.PVal),
+		NegLog10PVal: formatMetaValue(metaResult.NegLog10PVal),
+		HetPVal:      formatMetaValue(metaResult.HetPVal),
+		I2:           formatMetaValue(metaResult.I2),
+		HetFlag:      hetFlag,
+		Q:            formatMetaValue(metaResult.Q),
+		DF:           strconv.Itoa(metaResult.NStudies - 1),
+	}
+}
+
+func formatMetaValue(value float64) string {
+	if math.IsNaN(value) {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(value)
+}
+
+// For MR-MEGA-style meta-regression
+type OutputMRMEGAStats struct {
+	PVal            string
+	AncestryHetPVal string
+}
+
+// The regression is not identifiable when the principal components are
+// collinear across the studies, its p-values are then missing.
+func formatMRMEGA(result meta.MRMEGAResult) OutputMRMEGAStats {
+	if math.IsNaN(result.PVal) {
+		return OutputMRMEGAStats{
+			PVal:            outputDefaultMissingValue,
+			AncestryHetPVal: outputDefaultMissingValue,
+		}
+	}
+
+	return OutputMRMEGAStats{
+		PVal:            formatFloat(result.PVal),
+		AncestryHetPVal: formatFloat(result.AncestryHetPVal),
+	}
+}
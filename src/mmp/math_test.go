@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"testing"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+func TestFormatMetaResultNaN(t *testing.T) {
+	// A sebeta of 0 leaves all the results undefined
+	result := meta.ComputeMeta([]meta.StudyEffect{
+		{Tag: "A", Beta: 0.1, SEBeta: 0},
+		{Tag: "B", Beta: 0.3, SEBeta: 0.1},
+	})
+	stats := formatMetaResult(result, 0.75)
+
+	for name, value := range map[string]string{
+		"beta":        stats.Beta,
+		"sebeta":      stats.SEBeta,
+		"pval":        stats.PVal,
+		"-log10 pval": stats.NegLog10PVal,
+		"het pval":    stats.HetPVal,
+		"I2":          stats.I2,
+		"het flag":    stats.HetFlag,
+		"Q":           stats.Q,
+	} {
+		if value != outputDefaultMissingValue {
+			t.Errorf("%s: expected %s, got %s", name, outputDefaultMissingValue, value)
+		}
+	}
+	if stats.DF != "1" {
+		t.Errorf("df: expected 1, got %s", stats.DF)
+	}
+}
+
+func TestFormatMetaResultSingleStudy(t *testing.T) {
+	// A single study has no heterogeneity to test, but has a meta-analysis
+	stats := formatMetaResult(meta.ComputeMeta([]meta.StudyEffect{{Tag: "A", Beta: 0.1, SEBeta: 0.05}}), 0.75)
+
+	if stats.Beta == outputDefaultMissingValue || stats.HetPVal != outputDefaultMissingValue || stats.HetFlag != "0" {
+		t.Errorf("expected a beta, a missing het pval and a het flag of 0, got %s, %s and %s", stats.Beta, stats.HetPVal, stats.HetFlag)
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"log"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+)
+
+// Backpressure of --max-memory on the readers of the input files. Every
+// memoryCheckRows rows, a reader checks the heap, and when it is above
+// memoryHighWater of the limit the readers pause while the garbage is
+// collected. Their consumers keep going meanwhile, so that the parsed rows
+// in flight are freed before more are read.
+//
+// The selection and the stats of the selected variants are not garbage: when
+// they alone take the heap above the limit, a collection can't bring it back
+// under it. The readers then go on with a warning, and only pause again once
+// the heap has grown by the margin between the high water mark and the limit,
+// so that they don't collect at every check.
+type memoryGovernor struct {
+	maxMemory string
+	limit     uint64
+
+	mutex     sync.Mutex
+	pauseAt   uint64
+	nPauses   int
+	overLimit bool
+}
+
+const memoryCheckRows = 10000
+const memoryHighWater = 0.9
+
+func newMemoryGovernor(maxMemory string, limit int64) *memoryGovernor {
+	return &memoryGovernor{
+		maxMemory: maxMemory,
+		limit:     uint64(limit),
+		pauseAt:   uint64(float64(limit) * memoryHighWater),
+	}
+}
+
+// Bytes of the heap objects, live or not yet collected
+func heapObjectsBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// Called by the readers between rows. The readers wait on each other, so that
+// a single one collects the garbage while the others pause.
+func (governor *memoryGovernor) wait(nRows int64) {
+	if governor == nil || nRows%memoryCheckRows != 0 {
+		return
+	}
+
+	governor.mutex.Lock()
+	defer governor.mutex.Unlock()
+	if heapObjectsBytes() < governor.pauseAt {
+		return
+	}
+
+	runtime.GC()
+	governor.nPauses++
+
+	heapBytes := heapObjectsBytes()
+	highWater := uint64(float64(governor.limit) * memoryHighWater)
+	governor.pauseAt = highWater
+	if heapBytes >= highWater {
+		governor.pauseAt = heapBytes + governor.limit - highWater
+	}
+	if heapBytes > governor.limit && !governor.overLimit {
+		governor.overLimit = true
+		log.Printf("WARNING: the data kept by the run, mostly the selected variants and their stats, takes %d MB, above --max-memory %s, so the memory use goes over it. Use stricter p-value thresholds or --max-selected to select fewer variants.", heapBytes>>20, governor.maxMemory)
+	}
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import "testing"
+
+func TestMemoryGovernor(t *testing.T) {
+	// The heap is always above a limit of 1 KB, so the readers pause once, and
+	// then only once the heap grows above the heap after the collection
+	governor := newMemoryGovernor("1K", 1<<10)
+	governor.wait(0)
+	if governor.nPauses != 1 || !governor.overLimit {
+		t.Fatalf("expected a pause over the limit, got %d pauses, over the limit: %v", governor.nPauses, governor.overLimit)
+	}
+	if governor.pauseAt <= governor.limit {
+		t.Errorf("expected the next pause above the limit of %d bytes, got %d", governor.limit, governor.pauseAt)
+	}
+	governor.wait(1)
+	if governor.nPauses != 1 {
+		t.Errorf("expected no check between every %d rows, got %d pauses", memoryCheckRows, governor.nPauses)
+	}
+
+	// Far below the limit, the readers never pause
+	governor = newMemoryGovernor("1T", 1<<40)
+	governor.wait(0)
+	if governor.nPauses != 0 || governor.overLimit {
+		t.Errorf("expected no pause, got %d pauses, over the limit: %v", governor.nPauses, governor.overLimit)
+	}
+
+	// Without --max-memory there is no governor
+	var noGovernor *memoryGovernor
+	noGovernor.wait(0)
+}
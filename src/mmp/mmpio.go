@@ -0,0 +1,443 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+)
+
+const outputDefaultMissingValue = "NA"
+
+// Run reads the inputs of the configuration and writes the outputs, with the
+// options of the runner.
+func (runner *Runner) Run(conf Conf) (err error) {
+	defer runner.recoverFailure(&err)
+	runner.start()
+
+	variantStats, selectedVariants := runner.collectVariantStats(conf)
+
+	fmt.Printf("[4/4] Computing heterogeneity tests & writing output to %s ...\n", runner.OutputPath)
+	runner.writeMMPOutput(conf, variantStats, selectedVariants)
+	if runner.ManhattanPath != "" {
+		fmt.Printf("- writing Manhattan plot data to %s\n", runner.ManhattanPath)
+		runner.writeManhattan(conf, variantStats)
+	}
+	if runner.VcfOutputPath != "" {
+		fmt.Printf("- writing GWAS-VCF output to %s\n", runner.VcfOutputPath)
+		runner.writeVcfOutput(conf, variantStats)
+	}
+	if runner.ReportPath != "" {
+		fmt.Printf("- writing run report to %s\n", runner.ReportPath)
+		runner.writeRunReport(conf, runner.ReportPath)
+	}
+	return nil
+}
+
+// CollectVariantStats selects the variants of the inputs and gathers their
+// stats from each input, aligned, with their finemapping. It returns the stats
+// of each selected variant, and whether it is significant in any input or only
+// suggestive. These stats can be given to StreamVariantResults.
+func (runner *Runner) CollectVariantStats(conf Conf) (_ map[CPRA][]OutputStats, _ map[CPRA]bool, err error) {
+	defer runner.recoverFailure(&err)
+	runner.start()
+
+	variantStats, selectedVariants := runner.collectVariantStats(conf)
+	return variantStats, selectedVariants, nil
+}
+
+func (runner *Runner) collectVariantStats(conf Conf) (map[CPRA][]OutputStats, map[CPRA]bool) {
+	for _, inputConf := range conf.Inputs {
+		if inputConf.FinemapFilepath != "" && !runner.NoFinemap {
+			runner.validateFinemapFiles(inputConf)
+		}
+		if inputConf.isManifest() {
+			runner.validateManifestFiles(inputConf)
+		}
+	}
+
+	if runner.RejectedLogPath != "" {
+		runner.startRejectedLog(runner.RejectedLogPath)
+	}
+
+	var selectedVariants map[CPRA]bool
+	if runner.SelectionPath != "" {
+		fmt.Printf("[1/4] Reading the variant selection from %s\n", runner.SelectionPath)
+		selectedVariants = runner.readSelection(runner.SelectionPath)
+	} else {
+		fmt.Println("[1/4] Scanning input files for variant selection...")
+		selectedVariants = runner.scanForVariantSelection(conf)
+	}
+	if len(selectedVariants) == 0 {
+		message := "No variant passes the p-value threshold of any input, the output will only have a header. Check the `pval_threshold` and `col_pval` of the inputs."
+		if runner.FailOnEmptySelection {
+			fail(message)
+		}
+		log.Print("WARNING: ", message)
+	}
+	if runner.SelectedBedPath != "" {
+		fmt.Printf("- writing selected variants to %s\n", runner.SelectedBedPath)
+		runner.writeSelectedBed(selectedVariants)
+	}
+	if runner.SaveSelectionPath != "" {
+		fmt.Printf("- saving the variant selection to %s\n", runner.SaveSelectionPath)
+		runner.writeSelection(runner.SaveSelectionPath, selectedVariants)
+	}
+
+	fmt.Println("[2/4] Finding variant statistics based on the variant selection...")
+	addSwappedVariants(conf, selectedVariants)
+	variantStats := runner.findVariantStats(conf, selectedVariants)
+	runner.stopRejectedLog()
+
+	checkReferenceAlignment(conf, variantStats)
+	checkAlleleConsistency(conf, variantStats)
+	checkTestOverlaps(conf, variantStats)
+
+	if runner.NoFinemap {
+		fmt.Println("[3/4] Skipping finemapping statistics")
+	} else {
+		fmt.Println("[3/4] Combining finemapping statistics...")
+		runner.combineFinemapping(conf, variantStats)
+	}
+
+	if runner.ClumpWindow > 0 {
+		fmt.Printf("- clumping variants within %d bp by %s p-value\n", runner.ClumpWindow, runner.ClumpBy)
+		variantStats = clumpVariants(variantStats, runner.ClumpWindow, runner.ClumpBy)
+	}
+
+	runner.warnZeroPVals(conf, variantStats)
+	if runner.SelfCheck {
+		fmt.Println("- self-check of the alignment of the betas to the variant alleles")
+		runner.selfCheck(conf, variantStats)
+	}
+
+	if runner.DumpStatsPath != "" {
+		fmt.Printf("- writing the parsed stats to %s\n", runner.DumpStatsPath)
+		runner.writeStatsDump(conf, variantStats)
+	}
+
+	return variantStats, selectedVariants
+}
+
+// The selected variants, with whether they are significant in any input
+// or only suggestive. The inputs are read in parallel, and their selected
+// variants all go to a single map, so that a variant selected in several
+// inputs is only held once.
+// With --truncate-selected, the smallest p-value of each selected variant is
+// also kept, and the selection is cut down to the --max-selected most
+// significant variants whenever it gets twice as large, which bounds its
+// memory.
+func (runner *Runner) scanForVariantSelection(conf Conf) map[CPRA]bool {
+	selectedVariants := make(map[CPRA]bool)
+	var minPVals map[CPRA]float64
+	if runner.TruncateSelected {
+		minPVals = make(map[CPRA]float64)
+	}
+
+	var wg sync.WaitGroup
+	cpraChannel := make(chan SelectedCPRA)
+
+	for _, inputConf := range selectionInputs(conf, runner.SelectionScope) {
+		wg.Add(1)
+		go func(inputConf InputConf) {
+			defer wg.Done()
+			defer runner.recoverRoutine()
+			runner.streamVariantsAboveThreshold(inputConf, cpraChannel)
+		}(inputConf)
+	}
+
+	go func() {
+		wg.Wait()
+		close(cpraChannel)
+	}()
+
+	truncated := false
+	for selected := range cpraChannel {
+		selectedVariants[selected.CPRA] = selectedVariants[selected.CPRA] || selected.Significant
+
+		if minPVals != nil {
+			if minPVal, found := minPVals[selected.CPRA]; !found || selected.PVal < minPVal {
+				minPVals[selected.CPRA] = selected.PVal
+			}
+			if int64(len(minPVals)) > 2*runner.MaxSelected {
+				keepMostSignificant(selectedVariants, minPVals, runner.MaxSelected)
+				truncated = true
+			}
+		} else if runner.MaxSelected > 0 && int64(len(selectedVariants)) > runner.MaxSelected {
+			failf("More than %d variants are selected (--max-selected). Check the p-value thresholds, or use --truncate-selected to keep the most significant ones.", runner.MaxSelected)
+		}
+	}
+	runner.checkFailure()
+
+	if minPVals != nil && (truncated || int64(len(minPVals)) > runner.MaxSelected) {
+		nSelected := fmt.Sprint(len(minPVals))
+		if truncated {
+			nSelected = fmt.Sprint("more than ", 2*runner.MaxSelected)
+		}
+		log.Printf("WARNING: %s variants are selected, only the %d with the smallest p-values are kept (--max-selected).", nSelected, runner.MaxSelected)
+		keepMostSignificant(selectedVariants, minPVals, runner.MaxSelected)
+	}
+
+	return selectedVariants
+}
+
+// Discovery inputs used for the variant selection, depending on the selection
+// scope:
+// - "all": all the inputs
+// - "tests": inputs compared in any heterogeneity test
+// - a heterogeneity test tag: inputs compared in this heterogeneity test
+func selectionInputs(conf Conf, scope string) []InputConf {
+	if scope == "all" {
+		return discoveryInputs(conf.Inputs)
+	}
+
+	scopeTags := make(map[string]bool)
+	for _, test := range conf.HeterogeneityTests {
+		if scope == "tests" || scope == test.Tag {
+			for _, tag := range test.Compare {
+				scopeTags[tag] = true
+			}
+		}
+	}
+	if len(scopeTags) == 0 {
+		fail("No input to select variants from with selection scope `", scope, "`. Use `all`, `tests` or the tag of a heterogeneity test.")
+	}
+
+	var inputs []InputConf
+	for _, inputConf := range discoveryInputs(conf.Inputs) {
+		if scopeTags[inputConf.Tag] {
+			inputs = append(inputs, inputConf)
+		}
+	}
+	if len(inputs) == 0 {
+		fail("No discovery input to select variants from with selection scope `", scope, "`, its inputs all have the `replication` role.")
+	}
+	return inputs
+}
+
+func (runner *Runner) findVariantStats(conf Conf, selectedVariants map[CPRA]bool) map[CPRA][]OutputStats {
+	variantMultipleStats := make(map[CPRA][]OutputStats)
+
+	var wg sync.WaitGroup
+	selectedRowChannel := make(chan InputSummaryStatsRow)
+
+	for _, inputConf := range conf.Inputs {
+		wg.Add(1)
+		go func(inputConf InputConf) {
+			defer wg.Done()
+			defer runner.recoverRoutine()
+			runner.streamRowsFromSelection(inputConf, selectedVariants, selectedRowChannel)
+		}(inputConf)
+	}
+
+	go func() {
+		wg.Wait()
+		close(selectedRowChannel)
+	}()
+
+	nDuplicates := make(map[string]int)
+	for parsedRow := range selectedRowChannel {
+		outputStats := outputStatsFromRow(parsedRow)
+
+		multipleOutputStats, found := variantMultipleStats[parsedRow.CPRA]
+		if !found {
+			var multipleOutputStats = []OutputStats{outputStats}
+			variantMultipleStats[parsedRow.CPRA] = multipleOutputStats
+		} else if idxDuplicate := indexOfStats(multipleOutputStats, parsedRow.Tag); idxDuplicate != -1 {
+			// The rows of an input come in file order, so the kept duplicate
+			// doesn't depend on the order the inputs are read in.
+			nDuplicates[parsedRow.Tag]++
+			duplicates := inputConfByTag(parsedRow.Tag, conf.Inputs).Duplicates
+			if keepDuplicate(duplicates, multipleOutputStats[idxDuplicate], outputStats) {
+				multipleOutputStats[idxDuplicate] = outputStats
+			}
+		} else {
+			multipleOutputStats = append(multipleOutputStats, outputStats)
+			variantMultipleStats[parsedRow.CPRA] = multipleOutputStats
+		}
+	}
+	runner.checkFailure()
+
+	for _, inputConf := range conf.Inputs {
+		if nDuplicates[inputConf.Tag] > 0 {
+			log.Printf("WARNING: %d duplicate rows of selected variants in input `%s`, only one row is kept for each variant.", nDuplicates[inputConf.Tag], inputConf.Tag)
+		}
+	}
+
+	return variantMultipleStats
+}
+
+func indexOfStats(multipleStats []OutputStats, tag string) int {
+	for ii, stats := range multipleStats {
+		if stats.Tag == tag {
+			return ii
+		}
+	}
+	return -1
+}
+
+// Whether a duplicate row of a variant replaces the row kept so far:
+//   - "min_pval" (default): the row with the smallest p-value is kept, the first
+//     one in case of a tie or missing p-values
+//   - "first" or "last": the first or last row of the input is kept
+func keepDuplicate(duplicates string, kept OutputStats, duplicate OutputStats) bool {
+	switch duplicates {
+	case "first":
+		return false
+	case "last":
+		return true
+	default:
+		keptPVal, err := parseFloat64NaN(kept.PVal)
+		logCheck("parsing p-value as float", err)
+		duplicatePVal, err := parseFloat64NaN(duplicate.PVal)
+		logCheck("parsing p-value as float", err)
+		return duplicatePVal < keptPVal || (math.IsNaN(keptPVal) && !math.IsNaN(duplicatePVal))
+	}
+}
+
+func outputStatsFromRow(row InputSummaryStatsRow) OutputStats {
+	return OutputStats{
+		Tag:    row.Tag,
+		PVal:   row.PVal,
+		Beta:   row.Beta,
+		SEBeta: row.SEBeta,
+		AF:     row.AF,
+
+		// If a finemapping file was provided for this input, then these
+		// will be eventually filled with the finemapping values.
+		PIP: row.PIP,
+		CS:  row.CS,
+
+		N:         row.N,
+		NCases:    row.NCases,
+		NControls: row.NControls,
+
+		Passthrough: row.Passthrough,
+		Annotations: row.Annotations,
+
+		InputRef: row.Ref,
+		InputAlt: row.Alt,
+	}
+}
+
+func (runner *Runner) combineFinemapping(conf Conf, variantStats map[CPRA][]OutputStats) {
+	// We need this:
+	// Tag => CPRA => InputFinemapRow
+	// that is gathered by reading the finemap files
+	//
+	// Then we iterate over variantStats,
+	// for each CPRA,
+	// we look at each Tag,
+	// and if there is  Tag => CPRA  match in the above, then we add
+	// the finemap stats.
+	finemapStatsGathering := make(map[string]map[CPRA]InputFinemapRow)
+
+	var wg sync.WaitGroup
+	finemapRowChannel := make(chan InputFinemapRow)
+
+	for _, inputConf := range conf.Inputs {
+		if inputConf.FinemapFilepath != "" {
+			wg.Add(1)
+			go func(inputConf InputConf) {
+				defer wg.Done()
+				defer runner.recoverRoutine()
+				runner.streamFinemapFile(inputConf, finemapRowChannel)
+			}(inputConf)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		close(finemapRowChannel)
+	}()
+
+	for finemapRow := range finemapRowChannel {
+		tagData, found := finemapStatsGathering[finemapRow.Tag]
+		if !found {
+			tagData = make(map[CPRA]InputFinemapRow)
+		}
+
+		tagData[finemapRow.CPRA] = finemapRow
+		finemapStatsGathering[finemapRow.Tag] = tagData
+	}
+	runner.checkFailure()
+
+	// Now time to combine with variantStats.
+	// The finemap rows are matched on the alleles of the input, which differ
+	// from the ones of the variant when the input was aligned on a reference.
+	nMatchedFinemapRows := make(map[string]int)
+	for cpra, multipleOutputStats := range variantStats {
+		for idxTag, outputStats := range multipleOutputStats {
+			if _, tagFound := finemapStatsGathering[outputStats.Tag]; tagFound {
+				inputCPRA := CPRA{cpra.Chrom, cpra.Pos, outputStats.InputRef, outputStats.InputAlt}
+				if finemapStats, cpraFound := finemapStatsGathering[outputStats.Tag][inputCPRA]; cpraFound {
+					variantStats[cpra][idxTag].PIP = finemapStats.PIP
+					variantStats[cpra][idxTag].CS = finemapStats.CS
+					nMatchedFinemapRows[outputStats.Tag]++
+				}
+			}
+		}
+	}
+
+	// Finemap rows without a matching selected variant are dropped. Many of
+	// them point to a build or harmonization mismatch with the summary stats.
+	for _, inputConf := range conf.Inputs {
+		tagData, found := finemapStatsGathering[inputConf.Tag]
+		if !found {
+			continue
+		}
+
+		nUnmatched := len(tagData) - nMatchedFinemapRows[inputConf.Tag]
+		if nUnmatched > 0 {
+			fmt.Printf("- %d of the %d finemap rows of %s have no matching selected variant\n", nUnmatched, len(tagData), inputConf.Tag)
+		}
+		if runner.ReportPath != "" {
+			runner.reportFinemapRows(inputConf.Tag, len(tagData), nUnmatched)
+		}
+
+		unmatchedRate := float64(nUnmatched) / float64(len(tagData))
+		if unmatchedRate > runner.MaxUnmatchedFinemap {
+			fail("Too many finemap rows of input `", inputConf.Tag, "` have no matching selected variant: ", nUnmatched, " of ", len(tagData), ", above --max-unmatched-finemap ", runner.MaxUnmatchedFinemap, ". Check that the finemap and summary stats files use the same genome build and alleles.")
+		}
+	}
+}
+
+// A build or chromosome naming mismatch between inputs shows up as almost no
+// selected variant having stats from more than one input of a test.
+func checkTestOverlaps(conf Conf, variantStats map[CPRA][]OutputStats) {
+	for _, test := range conf.HeterogeneityTests {
+		if test.MinOverlap == 0 {
+			continue
+		}
+
+		nVariants := 0
+		nOverlapping := 0
+		for cpra := range variantStats {
+			nStudies := 0
+			for _, stats := range testStats(test, cpra, variantStats, conf.Inputs) {
+				if contains(test.Compare, stats.Tag) {
+					nStudies++
+				}
+			}
+			if nStudies > 0 {
+				nVariants++
+			}
+			if nStudies >= 2 {
+				nOverlapping++
+			}
+		}
+		if nVariants == 0 {
+			continue
+		}
+
+		overlap := float64(nOverlapping) / float64(nVariants)
+		if overlap < test.MinOverlap {
+			message := fmt.Sprintf("Only %d of the %d selected variants of heterogeneity test `%s` have stats from at least 2 of its inputs (%.3g, below `min_overlap` %g). Check that its inputs use the same genome build and chromosome names.", nOverlapping, nVariants, test.Tag, overlap, test.MinOverlap)
+			if test.OnLowOverlap == "fail" {
+				fail(message)
+			}
+			log.Print("WARNING: ", message)
+		}
+	}
+}
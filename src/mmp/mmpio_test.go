@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Selection of 3 inputs of 100k rows sharing most of their variants, with a
+// loose p-value threshold so that most of the rows are selected and go
+// through the consumer of the selection:
+//
+//	go test -C src -run '^$' -bench ScanForVariantSelection -cpu 1,4,8 -benchmem ./mmp
+func BenchmarkScanForVariantSelection(b *testing.B) {
+	const nInputs = 3
+	const nRows = 100000
+
+	dir := b.TempDir()
+	var inputConfs []string
+	for ii := 0; ii < nInputs; ii++ {
+		filePath := filepath.Join(dir, fmt.Sprintf("dataset%d.tsv.gz", ii))
+		outFile, err := os.Create(filePath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		gzWriter := gzip.NewWriter(outFile)
+		io.WriteString(gzWriter, "Chrom\tPos\tRef\tAlt\tpval\tbeta\tsebeta\taf\n")
+		for jj := 0; jj < nRows; jj++ {
+			// Each input has a tenth of variants of its own
+			pos := jj
+			if jj%10 == 0 {
+				pos += (ii + 1) * nRows
+			}
+			pval := float64((jj*7+ii)%1000+1) / 1000
+			fmt.Fprintf(gzWriter, "1\t%d\tA\tG\t%g\t0.1\t0.02\t0.3\n", pos+1, pval)
+		}
+		if err := gzWriter.Close(); err != nil {
+			b.Fatal(err)
+		}
+		outFile.Close()
+
+		inputConfs = append(inputConfs, fmt.Sprintf(`{
+      "tag": "Dataset%d", "filepath": "%s", "col_chrom": "Chrom", "col_pos": "Pos", "col_ref": "Ref", "col_alt": "Alt",
+      "col_pval": "pval", "col_beta": "beta", "col_sebeta": "sebeta", "col_af": "af",
+      "pval_threshold": 0.8, "finemap_filepath": null}`, ii, filePath))
+	}
+	configPath := filepath.Join(dir, "config.json")
+	config := `{"inputs": [` + strings.Join(inputConfs, ", ") + `], "heterogeneity_tests": []}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	runner, err := Configure(DefaultOptions())
+	if err != nil {
+		b.Fatal(err)
+	}
+	conf, err := runner.ReadConf(configPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// The scan prints its progress
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stdout = stdout }()
+
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		runner.scanForVariantSelection(conf)
+	}
+}
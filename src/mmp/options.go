@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"compress/gzip"
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/FINNGEN/mmpio/meta"
+	"golang.org/x/exp/rand"
+)
+
+// Options of a run that are not part of the configuration file. The mmpio
+// command sets them from its command-line flags, named after them, for
+// example --gzip-level for GzipLevel.
+type Options struct {
+	// Version of MMP::io, for the header comment and the fingerprint
+	Version string
+	// Path of the configuration, for the header comment
+	ConfigPath string
+
+	// Outputs, the ones with an empty path are not written
+	OutputPath        string
+	RejectedLogPath   string
+	SelectedBedPath   string
+	SaveSelectionPath string
+	ReportPath        string
+	VcfOutputPath     string
+	ManhattanPath     string
+	DumpStatsPath     string
+
+	// Inputs other than the configuration file
+	SelectionPath string
+	GenesPath     string
+
+	// Reading of the configuration file
+	FailFast      bool
+	StrictConfig  bool
+	AutosomesOnly bool
+
+	// Variant selection
+	SelectionScope       string
+	FailOnEmptySelection bool
+	MaxSelected          int64
+	TruncateSelected     bool
+	HeadRows             int64
+	ClumpWindow          int64
+	ClumpBy              string
+	NoFinemap            bool
+	MaxUnmatchedFinemap  float64
+
+	// Statistics
+	I2FlagThreshold float64
+	ZeroPValFloor   float64
+	SelfCheck       bool
+	// Seed of the source of randomness of the statistical methods, left to
+	// its default when nil
+	Seed *uint64
+
+	// Layout of the TSV output
+	OutputNegLog10P   bool
+	OutputAFMean      bool
+	OutputPresentMask bool
+	ColumnGroups      string
+	StatMajor         bool
+	LongOutput        bool
+	SplitByTest       bool
+	MetaHits          bool
+	EmitSchema        bool
+	HeaderComment     bool
+	MetadataHeader    bool
+	LineTerminator    string
+	NoTrailingNewline bool
+	GzipLevel         int
+	// Permissions of the output files, 0666 minus the umask when nil
+	OutputMode *os.FileMode
+
+	// Resources
+	MaxMemory        string
+	ProgressInterval time.Duration
+}
+
+// The defaults of the options, also the defaults of the command-line flags
+func DefaultOptions() Options {
+	return Options{
+		ConfigPath:          "config.json",
+		OutputPath:          "mmp.tsv",
+		FailFast:            true,
+		SelectionScope:      "all",
+		ClumpBy:             "min",
+		MaxUnmatchedFinemap: 1,
+		I2FlagThreshold:     0.75,
+		ZeroPValFloor:       math.SmallestNonzeroFloat64,
+		ColumnGroups:        "cpra,inputs,meta",
+		LineTerminator:      "lf",
+		GzipLevel:           6,
+	}
+}
+
+// Configure validates the options and returns a runner using them.
+func Configure(runOptions Options) (_ *Runner, err error) {
+	runner := &Runner{Options: runOptions, stopped: make(chan struct{})}
+	defer runner.recoverFailure(&err)
+
+	validateColumnGroups(runOptions.ColumnGroups)
+	if runOptions.LongOutput && (runOptions.StatMajor || runOptions.ColumnGroups != "cpra,inputs,meta") {
+		fail("--long cannot be combined with --stat-major or --column-groups.")
+	}
+	if runOptions.SplitByTest && (runOptions.LongOutput || runOptions.StatMajor || runOptions.ColumnGroups != "cpra,inputs,meta") {
+		fail("--split-by-test cannot be combined with --long, --stat-major or --column-groups.")
+	}
+	if runOptions.MetaHits && (runOptions.LongOutput || runOptions.SplitByTest || runOptions.StatMajor || runOptions.ColumnGroups != "cpra,inputs,meta") {
+		fail("--meta-hits cannot be combined with --long, --split-by-test, --stat-major or --column-groups.")
+	}
+	if runOptions.ZeroPValFloor <= 0 || runOptions.ZeroPValFloor >= 1 {
+		fail("Invalid --zero-pval-floor ", runOptions.ZeroPValFloor, ". It must be between 0 and 1, both excluded.")
+	}
+	if runOptions.MaxSelected < 0 {
+		fail("Invalid --max-selected ", runOptions.MaxSelected, ". It must be a positive number of variants.")
+	}
+	if runOptions.TruncateSelected && runOptions.MaxSelected == 0 {
+		fail("--truncate-selected needs --max-selected.")
+	}
+	if runOptions.SelectionPath != "" && (runOptions.MaxSelected > 0 || runOptions.SelectionScope != "all") {
+		fail("--selection cannot be combined with --max-selected or --selection-scope, which apply to the scan of the inputs that it skips.")
+	}
+	if runOptions.HeadRows < 0 {
+		fail("Invalid --head ", runOptions.HeadRows, ". It must be a positive number of rows.")
+	}
+	if runOptions.HeadRows > 0 {
+		log.Printf("WARNING: only the first %d rows of each data file are read (--head), per file for the inputs given as a manifest, the output is partial.", runOptions.HeadRows)
+	}
+	if runOptions.LineTerminator != "lf" && runOptions.LineTerminator != "crlf" {
+		fail("Unrecognized --line-terminator `", runOptions.LineTerminator, "`. Possible values are: lf, crlf.")
+	}
+	if runOptions.GzipLevel < gzip.BestSpeed || runOptions.GzipLevel > gzip.BestCompression {
+		fail("Invalid --gzip-level ", runOptions.GzipLevel, ". It must be between 1 and 9.")
+	}
+	if runOptions.OutputMode != nil && *runOptions.OutputMode > 0777 {
+		fail("Invalid --output-mode ", *runOptions.OutputMode, ". It must be permissions, for example 0644.")
+	}
+
+	if runOptions.Seed != nil {
+		meta.Src = rand.NewSource(*runOptions.Seed)
+	}
+
+	// This is a soft limit: the Go runtime collects garbage more often when
+	// getting close to it, and the readers of the inputs pause to let it do
+	// so, but it can still go over it if the kept data needs it.
+	if runOptions.MaxMemory != "" {
+		limit, err := parseByteSize(runOptions.MaxMemory)
+		logCheck("parsing --max-memory", err)
+		debug.SetMemoryLimit(limit)
+		runner.readersMemory = newMemoryGovernor(runOptions.MaxMemory, limit)
+	}
+
+	return runner, nil
+}
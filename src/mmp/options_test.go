@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"testing"
+
+	"github.com/FINNGEN/mmpio/meta"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Samples drawn by a method using meta.Src, as a permutation test would
+func drawSamples(n int) []float64 {
+	chiSquared := distuv.ChiSquared{K: 1, Src: meta.Src}
+	samples := make([]float64, n)
+	for ii := range samples {
+		samples[ii] = chiSquared.Rand()
+	}
+	return samples
+}
+
+func TestConfigureSeed(t *testing.T) {
+	defer func() { meta.Src = nil }()
+
+	seededOptions := DefaultOptions()
+	seed := uint64(42)
+	seededOptions.Seed = &seed
+
+	if _, err := Configure(seededOptions); err != nil {
+		t.Fatal(err)
+	}
+	first := drawSamples(5)
+	if _, err := Configure(seededOptions); err != nil {
+		t.Fatal(err)
+	}
+	second := drawSamples(5)
+	for ii := range first {
+		if first[ii] != second[ii] {
+			t.Fatalf("sample %d differs between runs with the same seed: %v and %v", ii, first[ii], second[ii])
+		}
+	}
+
+	otherSeed := uint64(43)
+	seededOptions.Seed = &otherSeed
+	if _, err := Configure(seededOptions); err != nil {
+		t.Fatal(err)
+	}
+	other := drawSamples(5)
+	same := true
+	for ii := range first {
+		same = same && first[ii] == other[ii]
+	}
+	if same {
+		t.Error("runs with different seeds drew the same samples")
+	}
+}
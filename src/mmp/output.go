@@ -0,0 +1,1173 @@
+// SPDX-License-Identifier: MIT
+
+package mmp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+// Genome-wide significance of the meta p-values kept with --meta-hits
+const metaHitsPValThreshold = 5e-8
+
+func (runner *Runner) writeMMPOutput(conf Conf, combinedStatsVariants map[CPRA][]OutputStats, selectedVariants map[CPRA]bool) {
+	var outRecords [][]string
+
+	if runner.MetaHits && len(conf.HeterogeneityTests) == 0 {
+		fail("--meta-hits needs at least one heterogeneity test in the configuration file.")
+	}
+
+	statsCols := []string{"pval", "beta", "sebeta", "af"}
+	if !runner.NoFinemap {
+		statsCols = append(statsCols, "pip", "cs")
+	}
+
+	// Sample size columns are only in the output if some input has them.
+	// Inputs without them get NA.
+	var hasN, hasCaseControl bool
+	for _, inputConf := range conf.Inputs {
+		hasN = hasN || inputConf.hasSampleSize()
+		hasCaseControl = hasCaseControl || inputConf.ColNCases != ""
+	}
+	if hasN {
+		statsCols = append(statsCols, "n")
+	}
+	if hasCaseControl {
+		statsCols = append(statsCols, "ncases", "ncontrols")
+	}
+	if runner.OutputNegLog10P {
+		statsCols = append(statsCols, "neglog10p", "signed_neglog10p")
+	}
+	headerFields := []string{
+		"chrom",
+		"pos",
+		"ref",
+		"alt",
+	}
+
+	// Annotation fields are part of the variant fields, since there is only one
+	// value per variant.
+	headerFields = append(headerFields, conf.Annotations.Columns...)
+
+	// Variant-level AF across the inputs, weighted by sample size when all
+	// the inputs have one.
+	idxAFMean := -1
+	weightAFByN := true
+	for _, inputConf := range conf.Inputs {
+		weightAFByN = weightAFByN && inputConf.hasSampleSize()
+	}
+	if runner.OutputAFMean {
+		idxAFMean = len(headerFields)
+		headerFields = append(headerFields, "af_mean")
+	}
+
+	// One character per input, in the order of the configuration: 1 when the
+	// input has stats for the variant, 0 otherwise.
+	idxPresentMask := -1
+	if runner.OutputPresentMask {
+		idxPresentMask = len(headerFields)
+		headerFields = append(headerFields, "present_mask")
+	}
+
+	// Whether the variant passes the p-value threshold of some input
+	// (significant) or only the suggestive threshold (suggestive).
+	idxSelectionTier := -1
+	if hasSuggestiveThreshold(conf.Inputs) {
+		idxSelectionTier = len(headerFields)
+		headerFields = append(headerFields, "selection_tier")
+	}
+
+	// Nearest gene of the variant and its distance in bp, 0 inside the gene
+	var geneIndex GeneIndex
+	idxNearestGene := -1
+	if runner.GenesPath != "" {
+		fmt.Printf("- reading genes from %s\n", runner.GenesPath)
+		geneIndex = runner.readGeneIndex(runner.GenesPath)
+		idxNearestGene = len(headerFields)
+		headerFields = append(headerFields, "nearest_gene", "nearest_gene_distance")
+	}
+
+	lenCpraFields := len(headerFields)
+	nAnnotationConflicts := 0
+
+	for _, inputConf := range conf.Inputs {
+		for _, suffix := range statsCols {
+			field := fmt.Sprintf("%s_%s", inputConf.Tag, suffix)
+			headerFields = append(headerFields, field)
+		}
+	}
+
+	// Loop to add meta fields for each heterogeneity test
+	const lenMetaFields = 4
+	for _, test := range conf.HeterogeneityTests {
+		headerFields = append(headerFields,
+			fmt.Sprintf("%s_meta_beta", test.Tag),
+			fmt.Sprintf("%s_meta_sebeta", test.Tag),
+			fmt.Sprintf("%s_meta_pval", test.Tag),
+			fmt.Sprintf("%s_meta_hetpval", test.Tag),
+		)
+	}
+
+	// I² and Cochran's Q fields, only for the tests doing an inverse-variance
+	// weighted meta-analysis.
+	i2Offsets := make(map[string]int)
+	for _, test := range conf.HeterogeneityTests {
+		if test.isIVW() {
+			i2Offsets[test.Tag] = len(headerFields)
+			headerFields = append(headerFields,
+				fmt.Sprintf("%s_meta_i2", test.Tag),
+				fmt.Sprintf("%s_meta_het_flag", test.Tag),
+				fmt.Sprintf("%s_meta_q", test.Tag),
+				fmt.Sprintf("%s_meta_df", test.Tag),
+			)
+		}
+	}
+
+	// -log10 of the meta p-value, computed in log space so that it is still
+	// accurate when the p-value underflows.
+	metaNegLog10POffsets := make(map[string]int)
+	for _, test := range conf.HeterogeneityTests {
+		if runner.OutputNegLog10P && test.isIVW() {
+			metaNegLog10POffsets[test.Tag] = len(headerFields)
+			headerFields = append(headerFields, fmt.Sprintf("%s_meta_neglog10p", test.Tag))
+		}
+	}
+
+	// MR-MEGA fields come after all the meta fields, only for the tests
+	// that enable it.
+	mrmegaOffsets := make(map[string]int)
+	for _, test := range conf.HeterogeneityTests {
+		if test.MRMEGA {
+			mrmegaOffsets[test.Tag] = len(headerFields)
+			headerFields = append(headerFields,
+				fmt.Sprintf("%s_mrmega_pval", test.Tag),
+				fmt.Sprintf("%s_mrmega_ancestry_hetpval", test.Tag),
+			)
+		}
+	}
+
+	// Effective sample size of the meta-analysis, only for the tests
+	// where all the compared inputs have a sample size.
+	neffOffsets := make(map[string]int)
+	for _, test := range conf.HeterogeneityTests {
+		if testHasSampleSize(test, conf.Inputs) {
+			neffOffsets[test.Tag] = len(headerFields)
+			headerFields = append(headerFields, fmt.Sprintf("%s_meta_neff", test.Tag))
+		}
+	}
+
+	// Sample size weighted meta-analysis to compare with the inverse-variance
+	// weighted one, for the tests that enable it.
+	sampleSizeCheckOffsets := make(map[string]int)
+	for _, test := range conf.HeterogeneityTests {
+		if test.SampleSizeCheck {
+			sampleSizeCheckOffsets[test.Tag] = len(headerFields)
+			headerFields = append(headerFields,
+				fmt.Sprintf("%s_meta_ss_pval", test.Tag),
+				fmt.Sprintf("%s_meta_neglog10p_ratio", test.Tag),
+			)
+		}
+	}
+
+	// Passthrough fields of each input come last, since each input has its own.
+	passthroughOffsets := make(map[string]int)
+	for _, inputConf := range conf.Inputs {
+		passthroughOffsets[inputConf.Tag] = len(headerFields)
+		for _, column := range inputConf.PassthroughColumns {
+			headerFields = append(headerFields, fmt.Sprintf("%s_%s", inputConf.Tag, column))
+		}
+	}
+
+	columnOrder := runner.outputColumnOrder(outputLayout{
+		lenCpraFields:    lenCpraFields,
+		nInputs:          len(conf.Inputs),
+		lenStatsFields:   len(statsCols),
+		nTests:           len(conf.HeterogeneityTests),
+		lenMetaFields:    lenMetaFields,
+		passthroughStart: passthroughOffsets[conf.Inputs[0].Tag],
+		lenFields:        len(headerFields),
+	})
+
+	// With --split-by-test, each heterogeneity test has its own records with
+	// a subset of the fields.
+	extraMetaOffsets := []map[string]int{i2Offsets, metaNegLog10POffsets, mrmegaOffsets, neffOffsets, sampleSizeCheckOffsets}
+	extraMetaLengths := []int{4, 1, 2, 1, 2}
+	var schema []ColumnSchema
+	if runner.EmitSchema {
+		schema = outputSchemaColumns(conf, headerFields, lenCpraFields, statsCols, lenMetaFields, extraMetaOffsets, extraMetaLengths, passthroughOffsets)
+	}
+
+	var testFields [][]int
+	testRecords := make([][][]string, len(conf.HeterogeneityTests))
+	if runner.SplitByTest {
+		for ii, test := range conf.HeterogeneityTests {
+			fields := testOutputFields(test, conf, lenCpraFields, len(statsCols), lenMetaFields, extraMetaOffsets, extraMetaLengths, passthroughOffsets)
+			testFields = append(testFields, fields)
+			testRecords[ii] = append(testRecords[ii], reorderFields(headerFields, fields))
+			if runner.EmitSchema {
+				runner.writeSchema(testOutputPath(runner.OutputPath, test.Tag), reorderSchema(schema, fields))
+			}
+		}
+	}
+
+	// In the long format there is one record per variant and input, with the
+	// stats of the input followed by the meta fields of the variant.
+	// Passthrough fields are left out as they differ between inputs.
+	metaStart := lenCpraFields + len(conf.Inputs)*len(statsCols)
+	passthroughStart := passthroughOffsets[conf.Inputs[0].Tag]
+	if runner.LongOutput {
+		var longHeaderFields []string
+		longHeaderFields = append(longHeaderFields, headerFields[:lenCpraFields]...)
+		longHeaderFields = append(longHeaderFields, "tag")
+		longHeaderFields = append(longHeaderFields, statsCols...)
+		longHeaderFields = append(longHeaderFields, headerFields[metaStart:passthroughStart]...)
+		outRecords = append(outRecords, longHeaderFields)
+		if runner.EmitSchema {
+			var longSchema []ColumnSchema
+			longSchema = append(longSchema, schema[:lenCpraFields]...)
+			longSchema = append(longSchema, ColumnSchema{Name: "tag", Type: "string", Group: "input", Statistic: "tag"})
+			for _, statsCol := range statsCols {
+				longSchema = append(longSchema, ColumnSchema{Name: statsCol, Type: statisticType(statsCol), Group: "input", Statistic: statsCol})
+			}
+			longSchema = append(longSchema, schema[metaStart:passthroughStart]...)
+			runner.writeSchema(runner.OutputPath, longSchema)
+		}
+	} else if runner.MetaHits {
+		var hitsHeaderFields []string
+		hitsHeaderFields = append(hitsHeaderFields, headerFields[:lenCpraFields]...)
+		hitsHeaderFields = append(hitsHeaderFields, headerFields[metaStart:passthroughStart]...)
+		outRecords = append(outRecords, hitsHeaderFields)
+		if runner.EmitSchema {
+			runner.writeSchema(runner.OutputPath, append(append([]ColumnSchema{}, schema[:lenCpraFields]...), schema[metaStart:passthroughStart]...))
+		}
+	} else {
+		outRecords = append(outRecords, reorderFields(headerFields, columnOrder))
+		if runner.EmitSchema && !runner.SplitByTest {
+			runner.writeSchema(runner.OutputPath, reorderSchema(schema, columnOrder))
+		}
+	}
+
+	// Go map iteration order is random, so we go through the variants
+	// in genomic order to get a reproducible output.
+	// The TSV output is one of the consumers of the variant results
+	runner.streamVariantResults(conf, combinedStatsVariants, func(cpra CPRA, multipleStats []OutputStats, metaResults map[string]meta.MetaResult) {
+		// Initialize the record
+		record := make([]string, len(headerFields))
+		record[0] = cpra.Chrom
+		record[1] = cpra.Pos
+		record[2] = cpra.Ref
+		record[3] = cpra.Alt
+		annotations, nConflicts := variantAnnotations(conf.Annotations, multipleStats)
+		copy(record[4:], annotations)
+		nAnnotationConflicts += nConflicts
+		if idxAFMean != -1 {
+			record[idxAFMean] = formatAFMean(multipleStats, conf.Inputs, weightAFByN)
+		}
+		if idxPresentMask != -1 {
+			record[idxPresentMask] = presentMask(conf.Inputs, multipleStats)
+		}
+		if idxNearestGene != -1 {
+			record[idxNearestGene] = outputDefaultMissingValue
+			record[idxNearestGene+1] = outputDefaultMissingValue
+			if gene, distance, found := geneIndex.nearestGene(cpra.Chrom, parsePos(cpra.Pos)); found {
+				record[idxNearestGene] = gene.Name
+				record[idxNearestGene+1] = strconv.FormatInt(distance, 10)
+			}
+		}
+		if idxSelectionTier != -1 {
+			record[idxSelectionTier] = "suggestive"
+			if selectedVariants[cpra] {
+				record[idxSelectionTier] = "significant"
+			}
+		}
+
+		for ii := lenCpraFields; ii < len(headerFields); ii++ {
+			// If a summary stats file doesn't contain a given CPRA, then
+			// we will show "NA" in the output for its stats.
+			// If has the given CPRA, then the "NA" will be overwritten
+			// by the actual summary stats values in the next step.
+			record[ii] = outputDefaultMissingValue
+		}
+
+		// Add summary statistics for each of the input
+		for _, stats := range multipleStats {
+			var offset int
+			for ii, inputConf := range conf.Inputs {
+				if inputConf.Tag == stats.Tag {
+					offset = lenCpraFields + ii*len(statsCols)
+				}
+			}
+			for jj, statsCol := range statsCols {
+				record[offset+jj] = runner.statsColumn(stats, statsCol)
+			}
+			for jj, value := range stats.Passthrough {
+				record[passthroughOffsets[stats.Tag]+jj] = value
+			}
+		}
+
+		isMetaHit := false
+
+		// Calculate meta stats here
+		for _, test := range conf.HeterogeneityTests {
+			multipleTestStats := testStats(test, cpra, combinedStatsVariants, conf.Inputs)
+			tagsWithEffects, tagsWithDirection, tagsWithPVal := TagsWithStats(multipleTestStats)
+			studies := runner.testStudies(test, multipleTestStats, conf.Inputs)
+
+			// Don't compute the meta stats if some stats are missing
+			metaStats := OutputMetaStats{
+				Beta:    "NA",
+				SEBeta:  "NA",
+				PVal:    "NA",
+				HetPVal: "NA",
+				I2:      "NA",
+				HetFlag: "NA",
+				Q:       "NA",
+				DF:      "NA",
+
+				NegLog10PVal: "NA",
+			}
+
+			switch test.Combine {
+			case "fisher", "stouffer":
+				if pval, found := combinedPVal(test, studies, tagsWithDirection, tagsWithPVal); found {
+					metaStats.PVal = formatFloat(pval)
+				}
+			default:
+				if metaResult, found := metaResults[test.Tag]; found {
+					metaStats = formatMetaResult(metaResult, runner.I2FlagThreshold)
+				}
+			}
+
+			offset := lenCpraFields + len(conf.Inputs)*len(statsCols) + indexOfTest(test.Tag, conf.HeterogeneityTests)*lenMetaFields
+			record[offset+0] = metaStats.Beta
+			record[offset+1] = metaStats.SEBeta
+			record[offset+2] = metaStats.PVal
+			record[offset+3] = metaStats.HetPVal
+			if metaPVal, err := parseFloat64NaN(metaStats.PVal); err == nil && metaPVal < metaHitsPValThreshold {
+				isMetaHit = true
+			}
+
+			if i2Offset, found := i2Offsets[test.Tag]; found {
+				record[i2Offset+0] = metaStats.I2
+				record[i2Offset+1] = metaStats.HetFlag
+				record[i2Offset+2] = metaStats.Q
+				record[i2Offset+3] = metaStats.DF
+			}
+
+			if metaNegLog10POffset, found := metaNegLog10POffsets[test.Tag]; found {
+				record[metaNegLog10POffset] = metaStats.NegLog10PVal
+			}
+
+			if test.MRMEGA && hasAllTags(tagsWithEffects, test.Compare) {
+				var betas []float64
+				var sebetas []float64
+				var pcs [][]float64
+				for _, study := range studies {
+					betas = append(betas, study.Beta)
+					sebetas = append(sebetas, study.SEBeta)
+					pcs = append(pcs, inputConfByTag(study.Tag, conf.Inputs).PC)
+				}
+				mrmegaStats := formatMRMEGA(meta.ComputeMRMEGA(betas, sebetas, pcs))
+
+				mrmegaOffset := mrmegaOffsets[test.Tag]
+				record[mrmegaOffset+0] = mrmegaStats.PVal
+				record[mrmegaOffset+1] = mrmegaStats.AncestryHetPVal
+			}
+
+			if neffOffset, found := neffOffsets[test.Tag]; found {
+				record[neffOffset] = formatMetaSampleSize(studies)
+			}
+
+			if sampleSizeCheckOffset, found := sampleSizeCheckOffsets[test.Tag]; found && hasAllTags(tagsWithEffects, test.Compare) && hasAllTags(tagsWithDirection, test.Compare) {
+				sampleSizePVal := meta.CombineStouffer(studies, true)
+				record[sampleSizeCheckOffset+0] = formatFloat(sampleSizePVal)
+				record[sampleSizeCheckOffset+1] = outputDefaultMissingValue
+				if metaResult, found := metaResults[test.Tag]; found {
+					record[sampleSizeCheckOffset+1] = formatNegLog10PRatio(metaResult.NegLog10PVal, sampleSizePVal)
+				}
+			}
+		}
+
+		if runner.SplitByTest {
+			for ii, test := range conf.HeterogeneityTests {
+				if testHasStats(test, testStats(test, cpra, combinedStatsVariants, conf.Inputs)) {
+					testRecords[ii] = append(testRecords[ii], reorderFields(record, testFields[ii]))
+				}
+			}
+			return
+		}
+		if runner.MetaHits {
+			if isMetaHit {
+				var hitsRecord []string
+				hitsRecord = append(hitsRecord, record[:lenCpraFields]...)
+				hitsRecord = append(hitsRecord, record[metaStart:passthroughStart]...)
+				outRecords = append(outRecords, hitsRecord)
+			}
+			return
+		}
+		if !runner.LongOutput {
+			outRecords = append(outRecords, reorderFields(record, columnOrder))
+			return
+		}
+		for ii, inputConf := range conf.Inputs {
+			if !hasStats(multipleStats, inputConf.Tag) {
+				continue
+			}
+			offset := lenCpraFields + ii*len(statsCols)
+
+			var longRecord []string
+			longRecord = append(longRecord, record[:lenCpraFields]...)
+			longRecord = append(longRecord, inputConf.Tag)
+			longRecord = append(longRecord, record[offset:offset+len(statsCols)]...)
+			longRecord = append(longRecord, record[metaStart:passthroughStart]...)
+			outRecords = append(outRecords, longRecord)
+		}
+	})
+
+	if conf.Annotations.WarnConflicts && nAnnotationConflicts > 0 {
+		log.Printf("WARNING: %d annotation values differ from the ones of the annotations source `%s`.", nAnnotationConflicts, conf.Annotations.Source)
+	}
+
+	if runner.SplitByTest {
+		for ii, test := range conf.HeterogeneityTests {
+			testPath := testOutputPath(runner.OutputPath, test.Tag)
+			fmt.Printf("- writing the output of %s to %s\n", test.Tag, testPath)
+			runner.writeTsvOutput(testPath, runner.headerComments(conf), testRecords[ii], "writing TSV output")
+		}
+		return
+	}
+
+	runner.writeTsvOutput(runner.OutputPath, runner.headerComments(conf), outRecords, "writing TSV output")
+}
+
+// Comment lines written before the header of the TSV output, without their
+// leading #. With --header-comment the first line has the provenance of the
+// output, then with --metadata-header come the metadata of the inputs, one
+// line per input and key, for example `# Dataset1 doi: 10.1000/xyz`.
+func (runner *Runner) headerComments(conf Conf) []string {
+	var comments []string
+	if runner.HeaderComment {
+		version := runner.Version
+		if version == "" {
+			version = "unknown"
+		}
+		comments = append(comments, fmt.Sprintf("mmpio version: %s; command: %s; config: %s; config sha256: %s", version, commandLine(), runner.ConfigPath, conf.configHash))
+	}
+	if runner.MetadataHeader {
+		for _, inputConf := range conf.Inputs {
+			for _, key := range sortedKeys(inputConf.Metadata) {
+				comments = append(comments, fmt.Sprintf("%s %s: %s", inputConf.Tag, key, inputConf.Metadata[key]))
+			}
+		}
+	}
+	return comments
+}
+
+// The arguments with spaces or quotes are single-quoted, so that the command
+// can be copied to a shell.
+func commandLine() string {
+	args := make([]string, len(os.Args))
+	for ii, arg := range os.Args {
+		args[ii] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t'\"$\\") {
+			args[ii] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// Write one of the TSV outputs, with the line terminator of --line-terminator,
+// and without the last one with --no-trailing-newline.
+func (runner *Runner) writeTsvOutput(filePath string, comments []string, records [][]string, description string) {
+	outWriter, closeOutput := runner.createCompressed(filePath)
+	defer closeOutput()
+
+	if runner.NoTrailingNewline {
+		outWriter = &trailingNewlineTrimmer{writer: outWriter}
+	}
+	writeRecords(outWriter, comments, records, runner.LineTerminator == "crlf", description)
+}
+
+// Write records of tab-separated values that are not one of the TSV outputs,
+// such as the BED output or the saved selection, with \n line terminators.
+func (runner *Runner) writeTsvRecords(filePath string, comments []string, records [][]string, description string) {
+	outWriter, closeOutput := runner.createCompressed(filePath)
+	defer closeOutput()
+
+	writeRecords(outWriter, comments, records, false, description)
+}
+
+func writeRecords(outWriter io.Writer, comments []string, records [][]string, useCRLF bool, description string) {
+	newline := "\n"
+	if useCRLF {
+		newline = "\r\n"
+	}
+	for _, comment := range comments {
+		// Values spanning several lines would end the comment
+		comment = strings.NewReplacer("\r", " ", "\n", " ").Replace(comment)
+		_, err := io.WriteString(outWriter, "# "+comment+newline)
+		logCheck(description, err)
+	}
+
+	tsvWriter := csv.NewWriter(outWriter)
+	tsvWriter.Comma = '\t'
+	tsvWriter.UseCRLF = useCRLF
+	tsvWriter.WriteAll(records)
+	err := tsvWriter.Error()
+	logCheck(description, err)
+}
+
+// The output of a heterogeneity test with --split-by-test has its tag before
+// the extension of the output path, for example out.meta1.tsv.gz for out.tsv.gz.
+func testOutputPath(outputPath string, tag string) string {
+	compressionExt := ""
+	if strings.HasSuffix(outputPath, ".gz") {
+		compressionExt = ".gz"
+	}
+	basePath := strings.TrimSuffix(outputPath, compressionExt)
+	ext := filepath.Ext(basePath)
+	return strings.TrimSuffix(basePath, ext) + "." + tag + ext + compressionExt
+}
+
+// Fields of the output of a heterogeneity test with --split-by-test: the
+// variant fields, then the fields of the compared inputs, then the fields of
+// the test.
+func testOutputFields(test HeterogeneityTestConf, conf Conf, lenCpraFields int, lenStatsFields int, lenMetaFields int, extraMetaOffsets []map[string]int, extraMetaLengths []int, passthroughOffsets map[string]int) []int {
+	fields := fieldRange(0, lenCpraFields)
+	for ii, inputConf := range conf.Inputs {
+		if contains(test.Compare, inputConf.Tag) {
+			offset := lenCpraFields + ii*lenStatsFields
+			fields = append(fields, fieldRange(offset, offset+lenStatsFields)...)
+		}
+	}
+
+	metaOffset := lenCpraFields + len(conf.Inputs)*lenStatsFields + indexOfTest(test.Tag, conf.HeterogeneityTests)*lenMetaFields
+	fields = append(fields, fieldRange(metaOffset, metaOffset+lenMetaFields)...)
+	for jj, offsets := range extraMetaOffsets {
+		if offset, found := offsets[test.Tag]; found {
+			fields = append(fields, fieldRange(offset, offset+extraMetaLengths[jj])...)
+		}
+	}
+
+	for _, inputConf := range conf.Inputs {
+		if contains(test.Compare, inputConf.Tag) {
+			offset := passthroughOffsets[inputConf.Tag]
+			fields = append(fields, fieldRange(offset, offset+len(inputConf.PassthroughColumns))...)
+		}
+	}
+	return fields
+}
+
+// Create a file for writing, gzip-compressing it when its name ends with .gz.
+// The data is written to a temporary file next to it, which is only renamed
+// to the file path when closed, so that a failed run never leaves a truncated
+// output behind: the temporary files left open are removed when the run
+// fails. The returned function closes and renames the file.
+func (runner *Runner) createCompressed(filePath string) (io.Writer, func()) {
+	outFile := runner.createTemp(filePath)
+	if runner.OutputMode != nil {
+		err := outFile.Chmod(*runner.OutputMode)
+		logCheck("setting output file mode", err)
+	}
+
+	closeFile := func() {
+		runner.releaseTemp(outFile)
+		err := outFile.Close()
+		logCheck("closing output file", err)
+		err = os.Rename(outFile.Name(), filePath)
+		logCheck("renaming output file", err)
+	}
+
+	if !strings.HasSuffix(filePath, ".gz") {
+		return outFile, closeFile
+	}
+
+	gzWriter, err := gzip.NewWriterLevel(outFile, runner.GzipLevel)
+	logCheck("creating gzip writer", err)
+
+	return gzWriter, func() {
+		err := gzWriter.Close()
+		logCheck("gzip-ing output file", err)
+		closeFile()
+	}
+}
+
+// Create the temporary file of an output, hidden in the same directory so that
+// it is renamed within the same file system. Unlike os.CreateTemp, which
+// creates it with mode 0600, it is created with mode 0666 so that the umask
+// applies, as for a file created in place.
+func (runner *Runner) createTemp(filePath string) *os.File {
+	for {
+		tempPath := filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		outFile, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		logCheck("creating output file", err)
+
+		runner.tempFilesMutex.Lock()
+		defer runner.tempFilesMutex.Unlock()
+		if runner.tempFiles == nil {
+			runner.tempFiles = make(map[*os.File]bool)
+		}
+		runner.tempFiles[outFile] = true
+		return outFile
+	}
+}
+
+func (runner *Runner) releaseTemp(outFile *os.File) {
+	runner.tempFilesMutex.Lock()
+	defer runner.tempFilesMutex.Unlock()
+	delete(runner.tempFiles, outFile)
+}
+
+// Remove the temporary files of the outputs that a failed run didn't finish
+func (runner *Runner) removeTempFiles() {
+	runner.tempFilesMutex.Lock()
+	defer runner.tempFilesMutex.Unlock()
+	for outFile := range runner.tempFiles {
+		outFile.Close()
+		os.Remove(outFile.Name())
+	}
+	runner.tempFiles = nil
+}
+
+// Holds back the line terminators at the end of the written data, and only
+// writes them when more data follows. This way the last line terminator of
+// the output is never written.
+type trailingNewlineTrimmer struct {
+	writer  io.Writer
+	pending []byte
+}
+
+func (trimmer *trailingNewlineTrimmer) Write(data []byte) (int, error) {
+	trimmed := bytes.TrimRight(data, "\r\n")
+	if len(trimmed) > 0 {
+		if _, err := trimmer.writer.Write(trimmer.pending); err != nil {
+			return 0, err
+		}
+		trimmer.pending = trimmer.pending[:0]
+		if _, err := trimmer.writer.Write(trimmed); err != nil {
+			return 0, err
+		}
+	}
+	trimmer.pending = append(trimmer.pending, data[len(trimmed):]...)
+
+	return len(data), nil
+}
+
+var outputColumnGroups = []string{"cpra", "inputs", "meta"}
+
+// Field ranges of the default output layout: the variant fields, the stats
+// blocks of each input, the meta blocks of each test followed by the other
+// meta fields, and the passthrough fields.
+type outputLayout struct {
+	lenCpraFields    int
+	nInputs          int
+	lenStatsFields   int
+	nTests           int
+	lenMetaFields    int
+	passthroughStart int
+	lenFields        int
+}
+
+// Indices of the default layout fields in the order given by --column-groups and --stat-major
+func (runner *Runner) outputColumnOrder(layout outputLayout) []int {
+	inputsStart := layout.lenCpraFields
+	metaStart := inputsStart + layout.nInputs*layout.lenStatsFields
+	extraMetaStart := metaStart + layout.nTests*layout.lenMetaFields
+
+	groupFields := map[string][]int{
+		"cpra":   fieldRange(0, layout.lenCpraFields),
+		"inputs": append(runner.blockFields(inputsStart, layout.nInputs, layout.lenStatsFields), fieldRange(layout.passthroughStart, layout.lenFields)...),
+		"meta":   append(runner.blockFields(metaStart, layout.nTests, layout.lenMetaFields), fieldRange(extraMetaStart, layout.passthroughStart)...),
+	}
+
+	var order []int
+	for _, group := range strings.Split(runner.ColumnGroups, ",") {
+		order = append(order, groupFields[group]...)
+	}
+	return order
+}
+
+// Indices of consecutive blocks of fields, block by block or, with
+// --stat-major, field by field across the blocks.
+func (runner *Runner) blockFields(start int, nBlocks int, lenBlock int) []int {
+	var fields []int
+	if !runner.StatMajor {
+		return fieldRange(start, start+nBlocks*lenBlock)
+	}
+	for jj := 0; jj < lenBlock; jj++ {
+		for ii := 0; ii < nBlocks; ii++ {
+			fields = append(fields, start+ii*lenBlock+jj)
+		}
+	}
+	return fields
+}
+
+func fieldRange(start int, end int) []int {
+	fields := make([]int, 0, end-start)
+	for ii := start; ii < end; ii++ {
+		fields = append(fields, ii)
+	}
+	return fields
+}
+
+func reorderFields(fields []string, order []int) []string {
+	reordered := make([]string, len(order))
+	for ii, field := range order {
+		reordered[ii] = fields[field]
+	}
+	return reordered
+}
+
+// Annotation values come from the annotations source, or from the first
+// fallback input having a value for the variant. Also returns the number of
+// values of the other inputs that differ from the chosen ones.
+func variantAnnotations(annotationConf AnnotationConf, multipleStats []OutputStats) ([]string, int) {
+	values := make([]string, len(annotationConf.Columns))
+	for ii := range values {
+		values[ii] = outputDefaultMissingValue
+	}
+
+	nConflicts := 0
+	annotationTags := append([]string{annotationConf.Source}, annotationConf.FallbackInputs...)
+	for _, tag := range annotationTags {
+		for _, stats := range multipleStats {
+			if stats.Tag != tag {
+				continue
+			}
+			for ii, value := range stats.Annotations {
+				if value == "" || value == outputDefaultMissingValue {
+					continue
+				}
+				if values[ii] == outputDefaultMissingValue {
+					values[ii] = value
+				} else if values[ii] != value {
+					nConflicts++
+				}
+			}
+		}
+	}
+
+	return values, nConflicts
+}
+
+// Write the selected variants as BED intervals, which are 0-based and half-open.
+// Each interval spans the ref allele of the variant.
+func (runner *Runner) writeSelectedBed(selectedVariants map[CPRA]bool) {
+	cpras := make([]CPRA, 0, len(selectedVariants))
+	for cpra := range selectedVariants {
+		cpras = append(cpras, cpra)
+	}
+	sortCPRAs(cpras)
+
+	var outRecords [][]string
+	for _, cpra := range cpras {
+		start := parsePos(cpra.Pos) - 1
+		end := start + int64(len(cpra.Ref))
+		outRecords = append(outRecords, []string{
+			cpra.Chrom,
+			strconv.FormatInt(start, 10),
+			strconv.FormatInt(end, 10),
+		})
+	}
+
+	runner.writeTsvRecords(runner.SelectedBedPath, nil, outRecords, "writing BED output")
+}
+
+// Write the -log10(p) of each input for the output variants, in long format
+// for plotting: one row per input and variant, inputs in the order of the
+// configuration file. Variants missing from an input are left out.
+func (runner *Runner) writeManhattan(conf Conf, combinedStatsVariants map[CPRA][]OutputStats) {
+	cpras := sortedCPRAs(combinedStatsVariants)
+
+	outRecords := [][]string{{"tag", "chrom", "pos", "neglog10p"}}
+	for _, inputConf := range conf.Inputs {
+		for _, cpra := range cpras {
+			for _, stats := range combinedStatsVariants[cpra] {
+				if stats.Tag != inputConf.Tag || stats.PVal == outputDefaultMissingValue {
+					continue
+				}
+				outRecords = append(outRecords, []string{
+					stats.Tag,
+					cpra.Chrom,
+					cpra.Pos,
+					runner.formatNegLog10P(stats.PVal, ""),
+				})
+			}
+		}
+	}
+
+	runner.writeTsvOutput(runner.ManhattanPath, nil, outRecords, "writing Manhattan output")
+}
+
+// The per-input stats of the output variants as they were parsed, before any
+// meta-analysis, one row per variant and input.
+func (runner *Runner) writeStatsDump(conf Conf, combinedStatsVariants map[CPRA][]OutputStats) {
+	dumpCols := []string{"pval", "beta", "sebeta", "af", "pip", "cs", "n", "ncases", "ncontrols"}
+
+	outRecords := [][]string{append([]string{"chrom", "pos", "ref", "alt", "tag"}, dumpCols...)}
+	for _, cpra := range sortedCPRAs(combinedStatsVariants) {
+		for _, inputConf := range conf.Inputs {
+			for _, stats := range combinedStatsVariants[cpra] {
+				if stats.Tag != inputConf.Tag {
+					continue
+				}
+				record := []string{cpra.Chrom, cpra.Pos, cpra.Ref, cpra.Alt, stats.Tag}
+				for _, dumpCol := range dumpCols {
+					record = append(record, runner.statsColumn(stats, dumpCol))
+				}
+				outRecords = append(outRecords, record)
+			}
+		}
+	}
+
+	runner.writeTsvOutput(runner.DumpStatsPath, nil, outRecords, "writing stats dump")
+}
+
+// Value of the stats for the given output column suffix.
+func (runner *Runner) statsColumn(stats OutputStats, statsCol string) string {
+	switch statsCol {
+	case "pval":
+		return stats.PVal
+	case "beta":
+		return stats.Beta
+	case "sebeta":
+		return stats.SEBeta
+	case "af":
+		return stats.AF
+	case "pip":
+		return stats.PIP
+	case "cs":
+		return stats.CS
+	case "n":
+		return stats.N
+	case "ncases":
+		return stats.NCases
+	case "ncontrols":
+		return stats.NControls
+	case "neglog10p":
+		return runner.formatNegLog10P(stats.PVal, "")
+	case "signed_neglog10p":
+		return runner.formatNegLog10P(stats.PVal, stats.Beta)
+	default:
+		fail("Unknown output stats column `", statsCol, "`.")
+		return ""
+	}
+}
+
+// -log10(p), signed by the direction of beta if given.
+func (runner *Runner) formatNegLog10P(pval string, beta string) string {
+	if pval == "NA" || beta == "NA" {
+		return outputDefaultMissingValue
+	}
+
+	parsedPVal, err := parseFloat64NaN(pval)
+	logCheck("parsing p-value as float", err)
+	negLog10P := meta.NegLog10(runner.floorZeroPVal(parsedPVal))
+
+	if beta != "" {
+		parsedBeta, err := parseFloat64NaN(beta)
+		logCheck("parsing beta as float", err)
+		negLog10P = math.Copysign(negLog10P, parsedBeta)
+	}
+
+	return formatFloat(negLog10P)
+}
+
+// Ratio of the -log10(p) of the inverse-variance weighted meta-analysis to the
+// one of the sample size weighted meta-analysis. It is far from 1 when the
+// standard errors of some input are miscalibrated. The -log10(p) of the
+// inverse-variance weighted meta-analysis is the one computed in log space, so
+// that the ratio stays defined for the strongest hits, whose p-value underflows.
+func formatNegLog10PRatio(ivwNegLog10PVal float64, sampleSizePVal float64) string {
+	ratio := ivwNegLog10PVal / meta.NegLog10(sampleSizePVal)
+	if math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(ratio)
+}
+
+// Some tools output a p-value of 0 for very strong associations. It is
+// replaced by --zero-pval-floor where the p-values are transformed, so that
+// their -log10 and z-scores stay finite. The output keeps the 0.
+func (runner *Runner) floorZeroPVal(pval float64) float64 {
+	if pval == 0 {
+		return runner.ZeroPValFloor
+	}
+	return pval
+}
+
+// Warn about the inputs with p-values of 0 among the output variants, since
+// the p-value floor then drives their -log10 p-values and meta p-values.
+func (runner *Runner) warnZeroPVals(conf Conf, combinedStatsVariants map[CPRA][]OutputStats) {
+	nZeroPVals := make(map[string]int)
+	for _, multipleStats := range combinedStatsVariants {
+		for _, stats := range multipleStats {
+			pval, err := parseFloat64NaN(stats.PVal)
+			logCheck("parsing p-value as float", err)
+			if pval == 0 {
+				nZeroPVals[stats.Tag]++
+			}
+		}
+	}
+
+	for _, inputConf := range conf.Inputs {
+		if nZeroPVals[inputConf.Tag] > 0 {
+			log.Printf("WARNING: %d output variants have a p-value of 0 in input `%s`, it is replaced by %g (--zero-pval-floor) when computing -log10 p-values and combined p-values.", nZeroPVals[inputConf.Tag], inputConf.Tag, runner.ZeroPValFloor)
+		}
+	}
+}
+
+func (runner *Runner) parseStudyEffect(stats OutputStats) meta.StudyEffect {
+	pval, err := parseFloat64NaN(stats.PVal)
+	logCheck("parsing p-value as float", err)
+
+	beta, err := parseFloat64NaN(stats.Beta)
+	logCheck("parsing beta as float", err)
+
+	sebeta, err := parseFloat64NaN(stats.SEBeta)
+	logCheck("parsing sebeta as float", err)
+
+	n, err := parseFloat64NaN(stats.N)
+	logCheck("parsing sample size as float", err)
+
+	return meta.StudyEffect{
+		Tag:    stats.Tag,
+		Beta:   beta,
+		SEBeta: sebeta,
+		PVal:   runner.floorZeroPVal(pval),
+		N:      n,
+	}
+}
+
+// P-value of a heterogeneity test combining the p-values of its inputs, when
+// they all have the stats needed by its method: only a p-value for Fisher's,
+// and also the direction of effect for Stouffer's.
+func combinedPVal(test HeterogeneityTestConf, studies []meta.StudyEffect, tagsWithDirection map[string]bool, tagsWithPVal map[string]bool) (float64, bool) {
+	switch test.Combine {
+	case "fisher":
+		if hasAllTags(tagsWithPVal, test.Compare) {
+			return meta.CombineFisher(studies), true
+		}
+	case "stouffer":
+		if hasAllTags(tagsWithDirection, test.Compare) {
+			if test.RequireConcordantDirection && !concordantDirection(studies) {
+				break
+			}
+			return meta.CombineStouffer(studies, test.WeightByN), true
+		}
+	}
+	return math.NaN(), false
+}
+
+func testHasSampleSize(test HeterogeneityTestConf, inputs []InputConf) bool {
+	for _, tag := range test.Compare {
+		if !inputConfByTag(tag, inputs).hasSampleSize() {
+			return false
+		}
+	}
+	return true
+}
+
+// The sample size of the meta-analysis is the sum of the sample sizes of the
+// studies having the variant.
+func formatMetaSampleSize(studies []meta.StudyEffect) string {
+	metaN := 0.0
+	hasN := false
+	for _, study := range studies {
+		if !math.IsNaN(study.N) {
+			metaN += study.N
+			hasN = true
+		}
+	}
+
+	if !hasN {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(metaN)
+}
+
+// Inputs with a missing AF, or a missing sample size when weighting by it,
+// are left out of the average, and so are the inputs with a minor allele
+// frequency, which is not the AF of the alt allele.
+func formatAFMean(multipleStats []OutputStats, inputs []InputConf, weightByN bool) string {
+	sumAF := 0.0
+	sumWeights := 0.0
+	for _, stats := range multipleStats {
+		if inputConfByTag(stats.Tag, inputs).AFIsMAF {
+			continue
+		}
+
+		af, err := parseFloat64NaN(stats.AF)
+		logCheck("parsing AF as float", err)
+
+		weight := 1.0
+		if weightByN {
+			weight, err = parseFloat64NaN(stats.N)
+			logCheck("parsing sample size as float", err)
+		}
+		if math.IsNaN(af) || math.IsNaN(weight) {
+			continue
+		}
+
+		sumAF += weight * af
+		sumWeights += weight
+	}
+
+	if sumWeights == 0 {
+		return outputDefaultMissingValue
+	}
+	return formatFloat(sumAF / sumWeights)
+}
+
+func presentMask(inputs []InputConf, multipleStats []OutputStats) string {
+	mask := make([]byte, len(inputs))
+	for ii, inputConf := range inputs {
+		mask[ii] = '0'
+		if hasStats(multipleStats, inputConf.Tag) {
+			mask[ii] = '1'
+		}
+	}
+	return string(mask)
+}
+
+// Whether any of the inputs compared in the test has the variant
+func testHasStats(test HeterogeneityTestConf, multipleStats []OutputStats) bool {
+	for _, tag := range test.Compare {
+		if hasStats(multipleStats, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasStats(multipleStats []OutputStats, tag string) bool {
+	for _, stats := range multipleStats {
+		if stats.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAllTags(tagsWithStats map[string]bool, tags []string) bool {
+	for _, tag := range tags {
+		if !tagsWithStats[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedCPRAs(variants map[CPRA][]OutputStats) []CPRA {
+	cpras := make([]CPRA, 0, len(variants))
+	for cpra := range variants {
+		cpras = append(cpras, cpra)
+	}
+	sortCPRAs(cpras)
+
+	return cpras
+}
+
+// Variants are in a total order, so that the output is the same across runs:
+// by chromosome, then position, then ref and alt alleles.
+func sortCPRAs(cpras []CPRA) {
+	sort.Slice(cpras, func(i, j int) bool {
+		if cpras[i].Chrom != cpras[j].Chrom {
+			return chromLess(cpras[i].Chrom, cpras[j].Chrom)
+		}
+		posI := parsePos(cpras[i].Pos)
+		posJ := parsePos(cpras[j].Pos)
+		if posI != posJ {
+			return posI < posJ
+		}
+		if cpras[i].Ref != cpras[j].Ref {
+			return cpras[i].Ref < cpras[j].Ref
+		}
+		return cpras[i].Alt < cpras[j].Alt
+	})
+}
+
+// Numeric chromosomes are sorted numerically and before the others (X, Y, MT, ...),
+// which are sorted alphabetically.
+func chromLess(chromA string, chromB string) bool {
+	numA, errA := strconv.Atoi(chromA)
+	numB, errB := strconv.Atoi(chromB)
+
+	switch {
+	case errA == nil && errB == nil && numA != numB:
+		return numA < numB
+	case errA == nil && errB == nil:
+		// Same number written differently, for example 1 and 01
+		return chromA < chromB
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	default:
+		return chromA < chromB
+	}
+}
+
+// Positions are always parsed as int64, since some assemblies have
+// coordinates beyond 2^31, and window arithmetic is done on them.
+func parsePos(pos string) int64 {
+	parsedPos, err := strconv.ParseInt(pos, 10, 64)
+	logCheck("parsing position as integer", err)
+	return parsedPos
+}
+
+func inputConfByTag(tag string, inputs []InputConf) InputConf {
+	for _, input := range inputs {
+		if input.Tag == tag {
+			return input
+		}
+	}
+	fail("Could not find input with tag `", tag, "` in the configuration.")
+	return InputConf{}
+}
+
+func indexOfTest(tag string, tests []HeterogeneityTestConf) int {
+	for i, test := range tests {
+		if test.Tag == tag {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfInput(tag string, inputs []InputConf) int {
+	for i, input := range inputs {
+		if input.Tag == tag {
+			return i
+		}
+	}
+	return -1
+}
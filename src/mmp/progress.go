@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Progress of reading an input file, reported at every --progress interval.
+// The percentage is the fraction of the file on disk read so far, which works
+// the same for compressed and uncompressed files. The total number of rows is
+// estimated from the mean row length so far and the uncompressed file size.
+type fileProgress struct {
+	filepath string
+	fileSize int64
+
+	// Uncompressed size from the gzip trailer, or -1 when unknown
+	gzipISize int64
+
+	compressedRead   atomic.Int64
+	uncompressedRead atomic.Int64
+	nRows            atomic.Int64
+}
+
+type countingReader struct {
+	reader io.Reader
+	nBytes *atomic.Int64
+	nRows  *atomic.Int64
+}
+
+func (counting countingReader) Read(buffer []byte) (int, error) {
+	nRead, err := counting.reader.Read(buffer)
+	counting.nBytes.Add(int64(nRead))
+	if counting.nRows != nil {
+		counting.nRows.Add(int64(bytes.Count(buffer[:nRead], []byte{'\n'})))
+	}
+	return nRead, err
+}
+
+// Wrap the file reader and the decompressed reader of a file to count the
+// bytes and rows read, and report them until the returned function is called.
+func (runner *Runner) trackProgress(filepath string, compressionType string, fReader *os.File, openReader func(io.Reader) (io.Reader, func())) (io.Reader, func()) {
+	fileInfo, err := fReader.Stat()
+	logCheck("reading file size", err)
+
+	progress := &fileProgress{
+		filepath:  filepath,
+		fileSize:  fileInfo.Size(),
+		gzipISize: -1,
+	}
+	if compressionType == "gzip" {
+		progress.gzipISize = gzipTrailerSize(fReader, progress.fileSize)
+	}
+
+	compressedReader := countingReader{reader: fReader, nBytes: &progress.compressedRead}
+	dataReader, closeReader := openReader(compressedReader)
+	dataReader = countingReader{reader: dataReader, nBytes: &progress.uncompressedRead, nRows: &progress.nRows}
+
+	ticker := time.NewTicker(runner.ProgressInterval)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				progress.report()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return dataReader, func() {
+		ticker.Stop()
+		close(done)
+		closeReader()
+	}
+}
+
+func (progress *fileProgress) report() {
+	compressedRead := progress.compressedRead.Load()
+	uncompressedRead := progress.uncompressedRead.Load()
+	nRows := progress.nRows.Load()
+	if compressedRead == 0 || uncompressedRead == 0 || progress.fileSize == 0 {
+		return
+	}
+
+	percent := 100 * float64(compressedRead) / float64(progress.fileSize)
+	totalSize := progress.estimatedUncompressedSize(compressedRead, uncompressedRead)
+	totalRows := int64(float64(nRows) * float64(totalSize) / float64(uncompressedRead))
+	fmt.Printf("- reading %s: %.1f%%, %d rows of ~%d\n", progress.filepath, percent, nRows, totalRows)
+}
+
+// The gzip trailer has the uncompressed size modulo 2^32, so files above
+// 4 GiB uncompressed have several possible sizes. The one closest to the
+// size extrapolated from the compression ratio so far is used. Files with
+// several gzip members, such as bgzip ones, only have the size of their last
+// member in the trailer, so the extrapolated size is used when the trailer
+// size is smaller than what was already read.
+func (progress *fileProgress) estimatedUncompressedSize(compressedRead int64, uncompressedRead int64) int64 {
+	extrapolated := int64(float64(uncompressedRead) * float64(progress.fileSize) / float64(compressedRead))
+	if progress.gzipISize < 0 {
+		return extrapolated
+	}
+
+	const iSizeModulo = int64(1) << 32
+	nWraps := math.Round(float64(extrapolated-progress.gzipISize) / float64(iSizeModulo))
+	if nWraps < 0 {
+		nWraps = 0
+	}
+	candidate := progress.gzipISize + int64(nWraps)*iSizeModulo
+	if candidate < uncompressedRead {
+		return extrapolated
+	}
+	return candidate
+}
+
+// Read the ISIZE field of the gzip trailer, the last 4 bytes of the file.
+// Returns -1 if it can't be read.
+func gzipTrailerSize(fReader *os.File, fileSize int64) int64 {
+	// Smallest gzip file: 10 bytes header, 8 bytes trailer
+	if fileSize < 18 {
+		return -1
+	}
+
+	trailer := make([]byte, 4)
+	_, err := fReader.ReadAt(trailer, fileSize-4)
+	if err != nil {
+		return -1
+	}
+	return int64(binary.LittleEndian.Uint32(trailer))
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"encoding/csv"
+)
+
+// Reason codes of the rejected variants log
+const (
+	rejectedBelowThreshold = "below_threshold"
+	rejectedMissingPVal    = "missing_pval"
+	rejectedInvalidPVal    = "invalid_pval"
+	rejectedAFFilter       = "af_filter"
+	rejectedInfoFilter     = "info_filter"
+	rejectedContigFilter   = "contig_filter"
+)
+
+type RejectedVariant struct {
+	Tag string
+	CPRA
+	Reason string
+}
+
+func (runner *Runner) startRejectedLog(filePath string) {
+	outWriter, closeLog := runner.createCompressed(filePath)
+
+	runner.rejectedChannel = make(chan RejectedVariant)
+	runner.rejectedLogDone = make(chan bool)
+
+	// The writer also returns when the run stops, as the readers don't send
+	// the rejected variants anymore, and leaves the log to be removed.
+	go func() {
+		defer close(runner.rejectedLogDone)
+		defer runner.recoverRoutine()
+
+		tsvWriter := csv.NewWriter(outWriter)
+		tsvWriter.Comma = '\t'
+		tsvWriter.Write([]string{"tag", "chrom", "pos", "ref", "alt", "reason"})
+
+		for {
+			var rejected RejectedVariant
+			var open bool
+			select {
+			case rejected, open = <-runner.rejectedChannel:
+			case <-runner.stopped:
+				return
+			}
+			if !open {
+				break
+			}
+
+			tsvWriter.Write([]string{
+				rejected.Tag,
+				rejected.Chrom,
+				rejected.Pos,
+				rejected.Ref,
+				rejected.Alt,
+				rejected.Reason,
+			})
+		}
+
+		tsvWriter.Flush()
+		err := tsvWriter.Error()
+		logCheck("writing rejected variants log", err)
+		closeLog()
+	}()
+}
+
+func (runner *Runner) reportRejected(tag string, cpra CPRA, reason string) {
+	if runner.rejectedChannel != nil {
+		send(runner, runner.rejectedChannel, RejectedVariant{tag, cpra, reason})
+	}
+}
+
+func (runner *Runner) stopRejectedLog() {
+	if runner.rejectedChannel != nil {
+		close(runner.rejectedChannel)
+		<-runner.rejectedLogDone
+		runner.checkFailure()
+	}
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+// Median of the chi-squared distribution with 1 degree of freedom,
+// used as reference for the genomic inflation factor.
+const chiSquaredMedian = 0.454936423119572
+
+type RunReport struct {
+	// Tags of the inputs by role, only when some input has the replication role
+	Discovery   []string `json:"discovery,omitempty"`
+	Replication []string `json:"replication,omitempty"`
+
+	Inputs []InputReport `json:"inputs"`
+}
+
+// QC summary of the p-values of an input, computed during the variant selection.
+type InputReport struct {
+	Tag          string `json:"tag"`
+	NVariants    int    `json:"n_variants"`
+	NMissingPVal int    `json:"n_missing_pval"`
+
+	// Missing when the input has no p-value
+	LambdaGC *float64 `json:"lambda_gc"`
+
+	NPValBelow5e8  int `json:"n_pval_below_5e-8"`
+	NPValBelow1e5  int `json:"n_pval_below_1e-5"`
+	NPValBelow0_05 int `json:"n_pval_below_0.05"`
+
+	// Only for the inputs with a finemap file
+	NFinemapRows          *int `json:"n_finemap_rows,omitempty"`
+	NFinemapRowsUnmatched *int `json:"n_finemap_rows_unmatched,omitempty"`
+
+	// The metadata of the input configuration, as-is
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// The median p-value is estimated from counts of the p-values in bins of
+// -log10(p), so that the p-values don't have to be kept in memory. Medians
+// beyond the last bin, below 1e-50, are clamped to it.
+const pvalBinWidth = 0.001
+const pvalBinMax = 50
+
+// Summary of the p-values of an input, accumulated while the input is scanned.
+type pvalSummary struct {
+	nPVals         int
+	nMissingPVal   int
+	nPValBelow5e8  int
+	nPValBelow1e5  int
+	nPValBelow0_05 int
+	binCounts      []int
+}
+
+func newPValSummary() *pvalSummary {
+	return &pvalSummary{binCounts: make([]int, int(pvalBinMax/pvalBinWidth)+1)}
+}
+
+func (summary *pvalSummary) add(pval float64) {
+	if math.IsNaN(pval) {
+		summary.nMissingPVal++
+		return
+	}
+
+	summary.nPVals++
+	if pval < 5e-8 {
+		summary.nPValBelow5e8++
+	}
+	if pval < 1e-5 {
+		summary.nPValBelow1e5++
+	}
+	if pval < 0.05 {
+		summary.nPValBelow0_05++
+	}
+
+	bin := len(summary.binCounts) - 1
+	if negLog10PVal := meta.NegLog10(pval); negLog10PVal < pvalBinMax {
+		bin = int(negLog10PVal / pvalBinWidth)
+	}
+	summary.binCounts[bin]++
+}
+
+// The rank-th smallest -log10(p), estimated as the middle of its bin
+func (summary *pvalSummary) negLog10PValAtRank(rank int) float64 {
+	cumulative := 0
+	for bin, count := range summary.binCounts {
+		cumulative += count
+		if cumulative > rank {
+			return (float64(bin) + 0.5) * pvalBinWidth
+		}
+	}
+	return math.NaN()
+}
+
+// The chi-squared statistic with 1 degree of freedom of a p-value is the
+// square of its z-score, and is decreasing with the p-value, so its median is
+// computed from the median p-value.
+func (summary *pvalSummary) genomicInflation() float64 {
+	middle := summary.nPVals / 2
+	medianZ := meta.NormalZ(summary.negLog10PValAtRank(middle))
+	medianChiSquared := medianZ * medianZ
+	if summary.nPVals%2 == 0 {
+		otherZ := meta.NormalZ(summary.negLog10PValAtRank(middle - 1))
+		medianChiSquared = (medianChiSquared + otherZ*otherZ) / 2
+	}
+
+	return medianChiSquared / chiSquaredMedian
+}
+
+func (runner *Runner) reportInputPVals(tag string, summary *pvalSummary) {
+	inputReport := InputReport{
+		Tag:            tag,
+		NVariants:      summary.nPVals + summary.nMissingPVal,
+		NMissingPVal:   summary.nMissingPVal,
+		NPValBelow5e8:  summary.nPValBelow5e8,
+		NPValBelow1e5:  summary.nPValBelow1e5,
+		NPValBelow0_05: summary.nPValBelow0_05,
+	}
+
+	if summary.nPVals > 0 {
+		lambdaGC := summary.genomicInflation()
+		inputReport.LambdaGC = &lambdaGC
+	}
+
+	runner.reportMutex.Lock()
+	runner.report.Inputs = append(runner.report.Inputs, inputReport)
+	runner.reportMutex.Unlock()
+}
+
+// Finemap files are read after the variant selection, so their counts are
+// added to the report of the input, which is created if the input was not
+// part of the variant selection.
+func (runner *Runner) reportFinemapRows(tag string, nRows int, nUnmatched int) {
+	runner.reportMutex.Lock()
+	defer runner.reportMutex.Unlock()
+
+	inputReport := runner.findInputReport(tag)
+	inputReport.NFinemapRows = &nRows
+	inputReport.NFinemapRowsUnmatched = &nUnmatched
+}
+
+// Report of the input, created if it is not in the report yet.
+// Must be called with the report lock held.
+func (runner *Runner) findInputReport(tag string) *InputReport {
+	for ii := range runner.report.Inputs {
+		if runner.report.Inputs[ii].Tag == tag {
+			return &runner.report.Inputs[ii]
+		}
+	}
+	runner.report.Inputs = append(runner.report.Inputs, InputReport{Tag: tag})
+	return &runner.report.Inputs[len(runner.report.Inputs)-1]
+}
+
+func (runner *Runner) writeRunReport(conf Conf, filePath string) {
+	if len(discoveryInputs(conf.Inputs)) < len(conf.Inputs) {
+		for _, inputConf := range conf.Inputs {
+			if inputConf.isReplication() {
+				runner.report.Replication = append(runner.report.Replication, inputConf.Tag)
+			} else {
+				runner.report.Discovery = append(runner.report.Discovery, inputConf.Tag)
+			}
+		}
+	}
+
+	for _, inputConf := range conf.Inputs {
+		if len(inputConf.Metadata) > 0 {
+			runner.findInputReport(inputConf.Tag).Metadata = inputConf.Metadata
+		}
+	}
+
+	// Same input order as the configuration file
+	sort.SliceStable(runner.report.Inputs, func(ii, jj int) bool {
+		return indexOfInput(runner.report.Inputs[ii].Tag, conf.Inputs) < indexOfInput(runner.report.Inputs[jj].Tag, conf.Inputs)
+	})
+
+	data, err := json.MarshalIndent(runner.report, "", "  ")
+	logCheck("encoding run report", err)
+
+	outWriter, closeReport := runner.createCompressed(filePath)
+	_, err = outWriter.Write(append(data, '\n'))
+	logCheck("writing run report", err)
+	closeReport()
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+func TestGenomicInflation(t *testing.T) {
+	// Inflated p-values, the chi-squared statistics of uniform p-values
+	// scaled by 1.1, and a missing p-value
+	summary := newPValSummary()
+	chiSquared := distuv.ChiSquared{K: 1}
+	for ii := 1; ii <= 10000; ii++ {
+		summary.add(chiSquared.Survival(1.1 * chiSquared.Quantile(float64(ii)/10001)))
+	}
+	summary.add(math.NaN())
+
+	if summary.nPVals != 10000 || summary.nMissingPVal != 1 {
+		t.Errorf("expected 10000 p-values and 1 missing, got %d and %d", summary.nPVals, summary.nMissingPVal)
+	}
+	if lambdaGC := summary.genomicInflation(); math.Abs(lambdaGC-1.1) > 1e-3 {
+		t.Errorf("expected a genomic inflation factor of 1.1, got %v", lambdaGC)
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+// VariantResultFunc is called for each output variant with its stats from each
+// input, and with the inverse-variance weighted meta-analysis of the
+// heterogeneity tests whose inputs all have an effect for this variant, once
+// aligned on the reference of the test.
+type VariantResultFunc func(cpra CPRA, multipleStats []OutputStats, metaResults map[string]meta.MetaResult)
+
+// StreamVariantResults computes the meta-analyses of each variant, in genomic
+// order, and passes them to the consume function. This way the results can be
+// used without going through the TSV output.
+func (runner *Runner) StreamVariantResults(conf Conf, combinedStatsVariants map[CPRA][]OutputStats, consume VariantResultFunc) (err error) {
+	defer runner.recoverFailure(&err)
+	runner.checkFailure()
+
+	runner.streamVariantResults(conf, combinedStatsVariants, consume)
+	return nil
+}
+
+func (runner *Runner) streamVariantResults(conf Conf, combinedStatsVariants map[CPRA][]OutputStats, consume VariantResultFunc) {
+	for _, cpra := range sortedCPRAs(combinedStatsVariants) {
+		metaResults := make(map[string]meta.MetaResult)
+		for _, test := range conf.HeterogeneityTests {
+			multipleTestStats := testStats(test, cpra, combinedStatsVariants, conf.Inputs)
+			tagsWithEffects, _, _ := TagsWithStats(multipleTestStats)
+			if !test.isIVW() || !hasAllTags(tagsWithEffects, test.Compare) {
+				continue
+			}
+			studies := runner.testStudies(test, multipleTestStats, conf.Inputs)
+			if test.RequireConcordantDirection && !concordantDirection(studies) {
+				continue
+			}
+			metaResults[test.Tag] = ComputeTestMeta(studies, conf.SampleOverlap)
+		}
+
+		consume(cpra, combinedStatsVariants[cpra], metaResults)
+	}
+}
+
+// TagsWithStats checks which tags have the stats needed by the meta-analysis
+// methods: beta and sebeta, the direction of effect with a p-value, or only a
+// p-value.
+func TagsWithStats(multipleStats []OutputStats) (map[string]bool, map[string]bool, map[string]bool) {
+	tagsWithEffects := make(map[string]bool)
+	tagsWithDirection := make(map[string]bool)
+	tagsWithPVal := make(map[string]bool)
+	for _, stats := range multipleStats {
+		if stats.Beta != "NA" && stats.SEBeta != "NA" {
+			tagsWithEffects[stats.Tag] = true
+		}
+		if stats.PVal != "NA" {
+			tagsWithPVal[stats.Tag] = true
+			if stats.Beta != "NA" {
+				tagsWithDirection[stats.Tag] = true
+			}
+		}
+	}
+
+	return tagsWithEffects, tagsWithDirection, tagsWithPVal
+}
+
+// TestStudies are the studies of the inputs compared in a heterogeneity test,
+// with their effects on the liability scale if the test enables it.
+func (runner *Runner) TestStudies(test HeterogeneityTestConf, multipleStats []OutputStats, inputs []InputConf) (_ []meta.StudyEffect, err error) {
+	defer runner.recoverFailure(&err)
+	runner.checkFailure()
+
+	return runner.testStudies(test, multipleStats, inputs), nil
+}
+
+func (runner *Runner) testStudies(test HeterogeneityTestConf, multipleStats []OutputStats, inputs []InputConf) []meta.StudyEffect {
+	var studies []meta.StudyEffect
+	for _, stats := range multipleStats {
+		if !contains(test.Compare, stats.Tag) {
+			continue
+		}
+		study := runner.parseStudyEffect(stats)
+		if test.LiabilityScale {
+			inputConf := inputConfByTag(stats.Tag, inputs)
+			factor := meta.LiabilityScaleFactor(inputConf.Prevalence, inputConf.SamplePrevalence)
+			study.Beta *= factor
+			study.SEBeta *= factor
+		}
+		studies = append(studies, study)
+	}
+	return studies
+}
+
+// Whether the betas of the studies all have the same sign. A beta of 0 has no
+// direction, so it is never concordant.
+func concordantDirection(studies []meta.StudyEffect) bool {
+	nPositive := 0
+	nNegative := 0
+	for _, study := range studies {
+		if study.Beta > 0 {
+			nPositive++
+		} else if study.Beta < 0 {
+			nNegative++
+		}
+	}
+	return nPositive == len(studies) || nNegative == len(studies)
+}
+
+// ComputeTestMeta is the inverse-variance weighted meta-analysis of the
+// studies, corrected for the correlation of their errors when some of them
+// share samples.
+func ComputeTestMeta(studies []meta.StudyEffect, overlaps []SampleOverlapConf) meta.MetaResult {
+	var tags []string
+	for _, study := range studies {
+		tags = append(tags, study.Tag)
+	}
+	if !hasSampleOverlap(tags, overlaps) {
+		return meta.ComputeMeta(studies)
+	}
+	return meta.ComputeMetaCorrelated(studies, overlapCorrelations(studies, overlaps))
+}
+
+func hasSampleOverlap(tags []string, overlaps []SampleOverlapConf) bool {
+	for _, overlap := range overlaps {
+		if len(overlap.Inputs) == 2 && contains(tags, overlap.Inputs[0]) && contains(tags, overlap.Inputs[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Correlation matrix of the errors of the studies, in the order of the
+// studies, with 0 for the pairs of studies without sample overlap.
+func overlapCorrelations(studies []meta.StudyEffect, overlaps []SampleOverlapConf) [][]float64 {
+	correlations := make([][]float64, len(studies))
+	for ii := range studies {
+		correlations[ii] = make([]float64, len(studies))
+		correlations[ii][ii] = 1
+	}
+	for _, overlap := range overlaps {
+		if len(overlap.Inputs) != 2 {
+			continue
+		}
+		for ii, studyI := range studies {
+			for jj, studyJ := range studies {
+				if studyI.Tag == overlap.Inputs[0] && studyJ.Tag == overlap.Inputs[1] {
+					correlations[ii][jj] = overlap.Correlation
+					correlations[jj][ii] = overlap.Correlation
+				}
+			}
+		}
+	}
+	return correlations
+}
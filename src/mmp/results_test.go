@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: MIT
+package mmp_test
+
+import (
+	"compress/gzip"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FINNGEN/mmpio/meta"
+	"github.com/FINNGEN/mmpio/mmp"
+)
+
+func writeGzip(t *testing.T, filePath string, content string) {
+	t.Helper()
+	outFile, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outFile.Close()
+	gzWriter := gzip.NewWriter(outFile)
+	if _, err := gzWriter.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Embedders read a configuration, collect the stats of the selected variants
+// and consume the meta-analysis of each of them, without the TSV output.
+func TestStreamVariantResults(t *testing.T) {
+	dir := t.TempDir()
+	header := "Chrom\tPos\tRef\tAlt\tpval\tbeta\tsebeta\taf\n"
+	writeGzip(t, filepath.Join(dir, "dataset1.tsv.gz"), header+"1\t100\tA\tG\t1e-9\t0.2\t0.03\t0.3\n2\t200\tC\tT\t0.5\t0.01\t0.02\t0.2\n")
+	writeGzip(t, filepath.Join(dir, "dataset2.tsv.gz"), header+"1\t100\tA\tG\t1e-7\t0.18\t0.03\t0.31\n")
+
+	input := `{
+      "filepath": "%s", "col_chrom": "Chrom", "col_pos": "Pos", "col_ref": "Ref", "col_alt": "Alt",
+      "col_pval": "pval", "col_beta": "beta", "col_sebeta": "sebeta", "col_af": "af",
+      "pval_threshold": 1e-6, "finemap_filepath": null, "tag": `
+	config := `{"inputs": [` +
+		fmt.Sprintf(input, filepath.Join(dir, "dataset1.tsv.gz")) + `"Dataset1"}, ` +
+		fmt.Sprintf(input, filepath.Join(dir, "dataset2.tsv.gz")) + `"Dataset2"}],
+    "heterogeneity_tests": [{"tag": "meta1", "compare": ["Dataset1", "Dataset2"]}]}`
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := mmp.DefaultOptions()
+	options.OutputPath = filepath.Join(dir, "out.tsv")
+	runner, err := mmp.Configure(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := runner.ReadConf(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variantStats, selectedVariants, err := runner.CollectVariantStats(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant := mmp.CPRA{Chrom: "1", Pos: "100", Ref: "A", Alt: "G"}
+	if len(selectedVariants) != 1 || !selectedVariants[variant] {
+		t.Fatalf("expected only %v to be selected, got %v", variant, selectedVariants)
+	}
+
+	var consumed []mmp.CPRA
+	err = runner.StreamVariantResults(conf, variantStats, func(cpra mmp.CPRA, multipleStats []mmp.OutputStats, metaResults map[string]meta.MetaResult) {
+		consumed = append(consumed, cpra)
+		if len(multipleStats) != 2 {
+			t.Errorf("expected stats from 2 inputs for %v, got %d", cpra, len(multipleStats))
+		}
+		result, found := metaResults["meta1"]
+		if !found {
+			t.Fatalf("no meta-analysis for %v", cpra)
+		}
+		// Same standard errors, so the meta beta is the mean of the betas
+		if math.Abs(result.Beta-0.19) > 1e-12 {
+			t.Errorf("expected a meta beta of 0.19, got %g", result.Beta)
+		}
+		if math.Abs(result.SEBeta-0.03/math.Sqrt2) > 1e-12 {
+			t.Errorf("expected a meta sebeta of %g, got %g", 0.03/math.Sqrt2, result.SEBeta)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consumed) != 1 || consumed[0] != variant {
+		t.Errorf("expected the results of %v only, got %v", variant, consumed)
+	}
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Runner runs MMP::io with its options, and holds the state of its run. A
+// runner does one run at a time, several runners can run at the same time.
+// After an error, the runner keeps returning it, as the goroutines of the
+// failed run may still be returning.
+type Runner struct {
+	Options
+
+	// Configuration errors collected with --fail-fast=false, to report them
+	// all at once at the end of the validation.
+	configErrors []string
+
+	// The inputs are scanned concurrently, so their reports are added under a lock.
+	report      RunReport
+	reportMutex sync.Mutex
+
+	// When the rejected variants log is enabled, the rejected variants are
+	// sent over this channel and written by a single goroutine.
+	rejectedChannel chan RejectedVariant
+	rejectedLogDone chan bool
+
+	// Set from --max-memory, nil without it
+	readersMemory *memoryGovernor
+
+	// The temporary files of the outputs being written
+	tempFilesMutex sync.Mutex
+	tempFiles      map[*os.File]bool
+
+	// The first error of the run. Closing stopped makes the goroutines of
+	// the run return, so that the error is returned once they are done.
+	failureMutex sync.Mutex
+	failure      error
+	stopped      chan struct{}
+}
+
+// An error of the run. The functions of the run panic with it, and the
+// exported functions recover it as their returned error, so that the error
+// doesn't have to be passed up through the pipeline of the inputs.
+type runError struct {
+	err error
+}
+
+func fail(values ...any) {
+	panic(runError{errors.New(fmt.Sprint(values...))})
+}
+
+func failf(format string, values ...any) {
+	panic(runError{fmt.Errorf(format, values...)})
+}
+
+// The state of the previous run is reset, so that a runner can run again
+func (runner *Runner) start() {
+	runner.checkFailure()
+	runner.configErrors = nil
+	runner.report = RunReport{}
+	runner.rejectedChannel = nil
+	runner.rejectedLogDone = nil
+}
+
+// Record the error of the run, only the first one is kept
+func (runner *Runner) stop(err error) {
+	runner.failureMutex.Lock()
+	defer runner.failureMutex.Unlock()
+	if runner.failure == nil {
+		runner.failure = err
+		close(runner.stopped)
+	}
+}
+
+// Deferred by the exported functions, to return the error of the run, after
+// removing the outputs that it didn't finish.
+func (runner *Runner) recoverFailure(err *error) {
+	if recovered := recover(); recovered != nil {
+		failure, isRunError := recovered.(runError)
+		if !isRunError {
+			panic(recovered)
+		}
+		runner.stop(failure.err)
+	}
+
+	runner.failureMutex.Lock()
+	defer runner.failureMutex.Unlock()
+	if runner.failure != nil {
+		runner.removeTempFiles()
+		*err = runner.failure
+	}
+}
+
+// Deferred by the goroutines of the run, after closing their channel so that
+// it runs before: the error of the goroutine stops the run before its
+// consumer sees the end of the channel.
+func (runner *Runner) recoverRoutine() {
+	if recovered := recover(); recovered != nil {
+		failure, isRunError := recovered.(runError)
+		if !isRunError {
+			panic(recovered)
+		}
+		runner.stop(failure.err)
+	}
+}
+
+// Stop with the error of a goroutine of the run, once the data that it was
+// producing is consumed.
+func (runner *Runner) checkFailure() {
+	runner.failureMutex.Lock()
+	defer runner.failureMutex.Unlock()
+	if runner.failure != nil {
+		panic(runError{runner.failure})
+	}
+}
+
+func (runner *Runner) isStopped() bool {
+	select {
+	case <-runner.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Send a value to the next step of the pipeline, unless the run is stopped.
+// The goroutine returns when it is, as its values are not needed anymore.
+func send[T any](runner *Runner, channel chan<- T, value T) bool {
+	if runner.isStopped() {
+		return false
+	}
+
+	select {
+	case channel <- value:
+		return true
+	case <-runner.stopped:
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// An error in a reader of the inputs, which run in goroutines, is returned by
+// the run instead of exiting, and the runner keeps returning it. The outputs
+// being written, such as the rejected variants log, are removed.
+func TestRunReaderError(t *testing.T) {
+	dir := t.TempDir()
+	header := "Chrom\tPos\tRef\tAlt\tpval\tbeta\tsebeta\taf\n"
+	var rows strings.Builder
+	for ii := 1; ii <= 1000; ii++ {
+		fmt.Fprintf(&rows, "1\t%d\tA\tG\t1e-9\t0.2\t0.03\t0.3\n", ii)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dataset1.tsv"), []byte(header+rows.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `{"tag": "%s", "filepath": "%s", "col_chrom": "Chrom", "col_pos": "Pos", "col_ref": "Ref", "col_alt": "Alt",
+      "col_pval": "pval", "col_beta": "beta", "col_sebeta": "sebeta", "col_af": "af", "pval_threshold": 1e-6, "finemap_filepath": null}`
+	config := `{"inputs": [` +
+		fmt.Sprintf(input, "Dataset1", filepath.Join(dir, "dataset1.tsv")) + ", " +
+		fmt.Sprintf(input, "Dataset2", filepath.Join(dir, "missing.tsv")) + `],
+    "heterogeneity_tests": [{"tag": "meta1", "compare": ["Dataset1", "Dataset2"]}]}`
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions()
+	options.OutputPath = filepath.Join(dir, "out.tsv")
+	options.RejectedLogPath = filepath.Join(dir, "rejected.tsv")
+	runner, err := Configure(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := runner.ReadConf(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runner.Run(conf)
+	if err == nil || !strings.Contains(err.Error(), ":: opening file ::") {
+		t.Fatalf("expected the error of the missing input file, got %v", err)
+	}
+	for _, outputPath := range []string{options.OutputPath, options.RejectedLogPath} {
+		if _, statErr := os.Stat(outputPath); statErr == nil {
+			t.Errorf("expected no %s from the failed run", outputPath)
+		}
+	}
+	if tempPaths, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(tempPaths) > 0 {
+		t.Errorf("expected the temporary files to be removed, found %v", tempPaths)
+	}
+	if again := runner.Run(conf); again != err {
+		t.Errorf("expected the error of the failed run again, got %v", again)
+	}
+}
+
+func TestConfigureError(t *testing.T) {
+	options := DefaultOptions()
+	options.GzipLevel = 10
+	runner, err := Configure(options)
+	if runner != nil || err == nil || !strings.Contains(err.Error(), "Invalid --gzip-level 10") {
+		t.Errorf("expected the error of the invalid option, got %v", err)
+	}
+}
+
+func TestReadConfErrors(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"inputs": [], "heterogeneity_tests": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultOptions()
+	options.FailFast = false
+	runner, err := Configure(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runner.ReadConf(configPath)
+	if err == nil || !strings.HasPrefix(err.Error(), "2 errors in the configuration file:") {
+		t.Errorf("expected the collected configuration errors, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// Description of the columns of a TSV output, written by --emit-schema next
+// to it, so that the outputs can be read without parsing their header.
+type OutputSchema struct {
+	MissingValue string         `json:"missing_value"`
+	Columns      []ColumnSchema `json:"columns"`
+}
+
+// Group is variant for the variant columns, input for the stats and the
+// passthrough columns of an input, and test for the columns of a
+// heterogeneity test. Statistic is the column name without the input or test
+// tag, for example pval for Dataset1_pval.
+type ColumnSchema struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Group     string `json:"group"`
+	Input     string `json:"input,omitempty"`
+	Test      string `json:"test,omitempty"`
+	Statistic string `json:"statistic"`
+}
+
+// Schema of the output fields, in the order in which they are built by
+// writeMMPOutput, before any reordering.
+func outputSchemaColumns(conf Conf, headerFields []string, lenCpraFields int, statsCols []string, lenMetaFields int, extraMetaOffsets []map[string]int, extraMetaLengths []int, passthroughOffsets map[string]int) []ColumnSchema {
+	columns := make([]ColumnSchema, len(headerFields))
+	for ii := 0; ii < lenCpraFields; ii++ {
+		columns[ii] = ColumnSchema{Group: "variant", Statistic: headerFields[ii]}
+	}
+
+	for ii, inputConf := range conf.Inputs {
+		offset := lenCpraFields + ii*len(statsCols)
+		for jj, statsCol := range statsCols {
+			columns[offset+jj] = ColumnSchema{Group: "input", Input: inputConf.Tag, Statistic: statsCol}
+		}
+		for jj, column := range inputConf.PassthroughColumns {
+			columns[passthroughOffsets[inputConf.Tag]+jj] = ColumnSchema{Type: "string", Group: "input", Input: inputConf.Tag, Statistic: column}
+		}
+	}
+
+	metaStart := lenCpraFields + len(conf.Inputs)*len(statsCols)
+	for ii, test := range conf.HeterogeneityTests {
+		testFields := fieldRange(metaStart+ii*lenMetaFields, metaStart+(ii+1)*lenMetaFields)
+		for jj, offsets := range extraMetaOffsets {
+			if offset, found := offsets[test.Tag]; found {
+				testFields = append(testFields, fieldRange(offset, offset+extraMetaLengths[jj])...)
+			}
+		}
+		for _, field := range testFields {
+			columns[field] = ColumnSchema{Group: "test", Test: test.Tag, Statistic: strings.TrimPrefix(headerFields[field], test.Tag+"_")}
+		}
+	}
+
+	for ii := range columns {
+		columns[ii].Name = headerFields[ii]
+		if columns[ii].Type == "" {
+			columns[ii].Type = statisticType(columns[ii].Statistic)
+		}
+	}
+	return columns
+}
+
+// Type of the values of an output statistic: string, integer or float
+func statisticType(statistic string) string {
+	switch statistic {
+	case "pos", "nearest_gene_distance", "meta_df", "meta_het_flag":
+		return "integer"
+	case "chrom", "ref", "alt", "tag", "cs", "present_mask", "selection_tier", "nearest_gene":
+		return "string"
+	case "af_mean", "pval", "beta", "sebeta", "af", "pip", "n", "ncases", "ncontrols", "neglog10p", "signed_neglog10p":
+		return "float"
+	}
+	// Statistics of the heterogeneity tests
+	if strings.HasPrefix(statistic, "meta_") || strings.HasPrefix(statistic, "mrmega_") {
+		return "float"
+	}
+	// Annotation columns
+	return "string"
+}
+
+func reorderSchema(columns []ColumnSchema, order []int) []ColumnSchema {
+	reordered := make([]ColumnSchema, len(order))
+	for ii, field := range order {
+		reordered[ii] = columns[field]
+	}
+	return reordered
+}
+
+// The schema of out.tsv.gz is out.schema.json
+func schemaPath(outputPath string) string {
+	basePath := strings.TrimSuffix(outputPath, ".gz")
+	return strings.TrimSuffix(basePath, filepath.Ext(basePath)) + ".schema.json"
+}
+
+func (runner *Runner) writeSchema(outputPath string, columns []ColumnSchema) {
+	data, err := json.MarshalIndent(OutputSchema{MissingValue: outputDefaultMissingValue, Columns: columns}, "", "  ")
+	logCheck("encoding output schema", err)
+
+	outWriter, closeSchema := runner.createCompressed(schemaPath(outputPath))
+	_, err = outWriter.Write(append(data, '\n'))
+	logCheck("writing output schema", err)
+	closeSchema()
+}
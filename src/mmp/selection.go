@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"io"
+	"strings"
+)
+
+// A saved selection is a TSV file with one row per selected variant, in
+// genomic order, and whether it is significant or only suggestive:
+//
+//	chrom	pos	ref	alt	tier
+//	1	1000	A	G	significant
+var selectionHeader = []string{"chrom", "pos", "ref", "alt", "tier"}
+
+func (runner *Runner) writeSelection(filePath string, selectedVariants map[CPRA]bool) {
+	cpras := make([]CPRA, 0, len(selectedVariants))
+	for cpra := range selectedVariants {
+		cpras = append(cpras, cpra)
+	}
+	sortCPRAs(cpras)
+
+	outRecords := [][]string{selectionHeader}
+	for _, cpra := range cpras {
+		tier := "suggestive"
+		if selectedVariants[cpra] {
+			tier = "significant"
+		}
+		outRecords = append(outRecords, []string{cpra.Chrom, cpra.Pos, cpra.Ref, cpra.Alt, tier})
+	}
+
+	runner.writeTsvRecords(filePath, nil, outRecords, "writing variant selection")
+}
+
+// Read a selection saved by --save-selection, gzip-compressed if its name
+// ends with .gz, instead of scanning the inputs for it.
+func (runner *Runner) readSelection(filePath string) map[CPRA]bool {
+	compressionType := "uncompressed"
+	if strings.HasSuffix(filePath, ".gz") {
+		compressionType = "gzip"
+	}
+
+	tsvReader, header, closeTsv := runner.openTsv(filePath, compressionType)
+	defer closeTsv()
+	if strings.Join(header, "\t") != strings.Join(selectionHeader, "\t") {
+		fail("The selection file `", filePath, "` has the header `", strings.Join(header, " "), "` instead of `", strings.Join(selectionHeader, " "), "`. Write it with --save-selection.")
+	}
+
+	selectedVariants := make(map[CPRA]bool)
+	for {
+		row, err := tsvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		logCheck("parsing selection file", err)
+
+		cpra := CPRA{row[0], row[1], row[2], row[3]}
+		switch row[4] {
+		case "significant":
+			selectedVariants[cpra] = true
+		case "suggestive":
+			if _, found := selectedVariants[cpra]; !found {
+				selectedVariants[cpra] = false
+			}
+		default:
+			fail("Unrecognized tier `", row[4], "` in the selection file `", filePath, "`. Possible values are: significant, suggestive.")
+		}
+	}
+
+	return selectedVariants
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+// Number of output variants checked by --self-check
+const selfCheckSampleSize = 1000
+
+// Check, for a sample of the output variants, that the sign of the beta of
+// each input is the one of its input row for the alt allele of the variant.
+// Then check that the sign of the meta beta of each inverse-variance weighted
+// test is the one derived from these input betas. The expected signs come from
+// the raw columns of the input files, read once more without the parsing and
+// harmonization of the rows, so that they are derived independently from the
+// stats they check. Any mismatch stops MMP::io, as it points to a
+// harmonization bug.
+func (runner *Runner) selfCheck(conf Conf, variantStats map[CPRA][]OutputStats) {
+	cpras := sortedCPRAs(variantStats)
+	step := 1
+	if len(cpras) > selfCheckSampleSize {
+		step = len(cpras) / selfCheckSampleSize
+	}
+	var sample []CPRA
+	for ii := 0; ii < len(cpras) && len(sample) < selfCheckSampleSize; ii += step {
+		sample = append(sample, cpras[ii])
+	}
+
+	// Sampled variants to check, by input and position
+	inputPositions := make(map[string]map[ChromPos][]CPRA)
+	for _, cpra := range sample {
+		// The inputs aligned on the reference of a test are also checked for
+		// the variant of the reference, as their beta is flipped for it.
+		multipleStats := append([]OutputStats(nil), variantStats[cpra]...)
+		for _, test := range conf.HeterogeneityTests {
+			for _, stats := range testStats(test, cpra, variantStats, conf.Inputs) {
+				if !hasStats(multipleStats, stats.Tag) {
+					multipleStats = append(multipleStats, stats)
+				}
+			}
+		}
+		for _, stats := range multipleStats {
+			if stats.Beta == outputDefaultMissingValue {
+				continue
+			}
+			if _, found := inputPositions[stats.Tag]; !found {
+				inputPositions[stats.Tag] = make(map[ChromPos][]CPRA)
+			}
+			position := ChromPos{cpra.Chrom, cpra.Pos}
+			inputPositions[stats.Tag][position] = append(inputPositions[stats.Tag][position], cpra)
+		}
+	}
+
+	// Expected sign of the beta of each input for the sampled variants
+	expectedSigns := make(map[string]map[CPRA][]float64)
+	for _, inputConf := range conf.Inputs {
+		if positions, found := inputPositions[inputConf.Tag]; found {
+			expectedSigns[inputConf.Tag] = runner.rawBetaSigns(inputConf, positions)
+		}
+	}
+
+	var mismatches []string
+	for _, cpra := range sample {
+		variant := fmt.Sprintf("%s:%s:%s:%s", cpra.Chrom, cpra.Pos, cpra.Ref, cpra.Alt)
+		for _, stats := range variantStats[cpra] {
+			if stats.Beta == outputDefaultMissingValue {
+				continue
+			}
+			beta, err := parseFloat64NaN(stats.Beta)
+			logCheck("parsing beta as float", err)
+			if beta == 0 || math.IsNaN(beta) {
+				continue
+			}
+			if !containsFloat(expectedSigns[stats.Tag][cpra], math.Copysign(1, beta)) {
+				mismatches = append(mismatches, fmt.Sprintf("%s has beta %s in `%s` but its input rows have beta signs %v for its alt allele", variant, stats.Beta, stats.Tag, expectedSigns[stats.Tag][cpra]))
+			}
+		}
+
+		for _, test := range conf.HeterogeneityTests {
+			multipleTestStats := testStats(test, cpra, variantStats, conf.Inputs)
+			tagsWithEffects, _, _ := TagsWithStats(multipleTestStats)
+			if !test.isIVW() || !hasAllTags(tagsWithEffects, test.Compare) {
+				continue
+			}
+			studies := runner.testStudies(test, multipleTestStats, conf.Inputs)
+			expectedStudies := make([]meta.StudyEffect, len(studies))
+			for ii, study := range studies {
+				expectedStudies[ii] = study
+				if signs := expectedSigns[study.Tag][cpra]; len(signs) > 0 {
+					expectedStudies[ii].Beta = math.Copysign(study.Beta, signs[0])
+				}
+			}
+			metaBeta := ComputeTestMeta(studies, conf.SampleOverlap).Beta
+			expectedMetaBeta := ComputeTestMeta(expectedStudies, conf.SampleOverlap).Beta
+			if metaBeta*expectedMetaBeta < 0 {
+				mismatches = append(mismatches, fmt.Sprintf("%s has meta beta %g in `%s` but %g from its input rows", variant, metaBeta, test.Tag, expectedMetaBeta))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		nMismatches := len(mismatches)
+		const maxListed = 10
+		if nMismatches > maxListed {
+			mismatches = append(mismatches[:maxListed], "...")
+		}
+		failf("Self-check failed, %d betas are not aligned to the alleles of their variant:\n- %s", nMismatches, strings.Join(mismatches, "\n- "))
+	}
+	fmt.Printf("- self-check passed for %d variants\n", len(sample))
+}
+
+// Signs of the beta of the alt allele of the given variants, from the raw
+// columns of the rows of the input having their alleles, possibly swapped or
+// on the other strand. Only the configuration of the input declaring how to
+// read its columns is used: the alleles column, the position base, the effect
+// allele column, the multi-allelic rows, and the flip of the betas.
+func (runner *Runner) rawBetaSigns(inputConf InputConf, positions map[ChromPos][]CPRA) map[CPRA][]float64 {
+	columns := []string{inputConf.ColChrom, inputConf.ColPos, inputConf.ColRef, inputConf.ColAlt, inputConf.ColBeta}
+	if inputConf.ColAlleles != "" {
+		columns[2] = inputConf.ColAlleles
+		columns[3] = inputConf.ColAlleles
+	}
+	if inputConf.ColEffectAllele != "" {
+		columns = append(columns, inputConf.ColEffectAllele)
+	}
+
+	rowChannel := make(chan []string)
+	go func() {
+		defer close(rowChannel)
+		defer runner.recoverRoutine()
+		runner.streamInputFiles(inputConf, columns, rowChannel)
+	}()
+
+	signs := make(map[CPRA][]float64)
+	for row := range rowChannel {
+		pos, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if inputConf.positionBase() == 0 {
+			pos++
+		}
+		cpras, found := positions[ChromPos{row[0], strconv.FormatInt(pos, 10)}]
+		if !found {
+			continue
+		}
+
+		ref, alts := row[2], []string{row[3]}
+		if inputConf.ColAlleles != "" {
+			alleles := strings.Split(row[2], inputConf.allelesSeparator())
+			if len(alleles) != 2 {
+				continue
+			}
+			ref, alts[0] = alleles[0], alleles[1]
+			if inputConf.AllelesAltFirst {
+				ref, alts[0] = alleles[1], alleles[0]
+			}
+		}
+		betas := []string{row[4]}
+		if inputConf.SplitMultiallelic {
+			alts = strings.Split(row[3], ",")
+			betas = strings.Split(row[4], ",")
+		}
+
+		for ii, alt := range alts {
+			rawBeta := betas[0]
+			if len(betas) == len(alts) {
+				rawBeta = betas[ii]
+			}
+			beta, err := strconv.ParseFloat(rawBeta, 64)
+			if err != nil || beta == 0 || math.IsNaN(beta) {
+				continue
+			}
+			sign := math.Copysign(1, beta)
+			if inputConf.FlipBeta {
+				sign = -sign
+			}
+
+			effectAllele := alt
+			if inputConf.ColEffectAllele != "" {
+				effectAllele = row[5]
+			}
+			for _, cpra := range cpras {
+				if !equivalentAlleles(cpra.Ref, cpra.Alt, ref, alt) {
+					continue
+				}
+				switch {
+				case effectAllele == cpra.Alt:
+					signs[cpra] = append(signs[cpra], sign)
+				case effectAllele == cpra.Ref:
+					signs[cpra] = append(signs[cpra], -sign)
+				case complementAllele(effectAllele) == cpra.Alt:
+					signs[cpra] = append(signs[cpra], sign)
+				case complementAllele(effectAllele) == cpra.Ref:
+					signs[cpra] = append(signs[cpra], -sign)
+				}
+			}
+		}
+	}
+	runner.checkFailure()
+
+	return signs
+}
+
+func containsFloat(slice []float64, item float64) bool {
+	for _, elem := range slice {
+		if elem == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Stats of two inputs, the second one having the variant with its alleles
+// swapped and reporting the effect of the ref allele
+func selfCheckStats(t *testing.T, dir string) (*Runner, Conf, map[CPRA][]OutputStats) {
+	t.Helper()
+	files := map[string]string{
+		"dataset1.tsv": "Chrom\tPos\tRef\tAlt\tpval\tbeta\tsebeta\taf\n1\t100\tA\tG\t1e-9\t0.2\t0.03\t0.3\n",
+		"dataset2.tsv": "Chrom\tPos\tRef\tAlt\tEA\tpval\tbeta\tsebeta\taf\n1\t100\tG\tA\tG\t1e-7\t-0.4\t0.02\t0.7\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := `{"tag": "%s", "filepath": "%s", "col_chrom": "Chrom", "col_pos": "Pos", "col_ref": "Ref", "col_alt": "Alt",
+      "col_pval": "pval", "col_beta": "beta", "col_sebeta": "sebeta", "col_af": "af", "pval_threshold": 1e-6, "finemap_filepath": null%s}`
+	config := `{"inputs": [` +
+		fmt.Sprintf(input, "Dataset1", filepath.Join(dir, "dataset1.tsv"), "") + ", " +
+		fmt.Sprintf(input, "Dataset2", filepath.Join(dir, "dataset2.tsv"), `, "col_effect_allele": "EA"`) + `],
+    "heterogeneity_tests": [{"tag": "meta1", "compare": ["Dataset1", "Dataset2"], "reference": "Dataset1"}]}`
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := Configure(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := runner.ReadConf(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variantStats, _, err := runner.CollectVariantStats(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner, conf, variantStats
+}
+
+// The error of the self-check, as returned by the run
+func runSelfCheck(runner *Runner, conf Conf, variantStats map[CPRA][]OutputStats) (err error) {
+	defer runner.recoverFailure(&err)
+	runner.selfCheck(conf, variantStats)
+	return nil
+}
+
+func TestSelfCheck(t *testing.T) {
+	runner, conf, variantStats := selfCheckStats(t, t.TempDir())
+	if err := runSelfCheck(runner, conf, variantStats); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A flipped beta, as a harmonization bug would make, stops MMP::io with an
+// error.
+func TestSelfCheckFlippedBeta(t *testing.T) {
+	runner, conf, variantStats := selfCheckStats(t, t.TempDir())
+	variant := CPRA{"1", "100", "G", "A"}
+	for ii, stats := range variantStats[variant] {
+		if stats.Tag == "Dataset2" {
+			variantStats[variant][ii].Beta = flipSign(stats.Beta)
+		}
+	}
+
+	err := runSelfCheck(runner, conf, variantStats)
+	if err == nil || !strings.Contains(err.Error(), "Self-check failed, 2 betas are not aligned") {
+		t.Errorf("expected the beta and meta beta mismatches, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func logCheck(message string, err error) {
+	if err != nil {
+		panic(runError{fmt.Errorf(":: %s :: %w", message, err)})
+	}
+}
+
+func contains(slice []string, item string) bool {
+	for _, elem := range slice {
+		if elem == item {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNaN(slice []float64) bool {
+	floatNaN, _ := strconv.ParseFloat("NaN", 64)
+
+	for _, elem := range slice {
+		if elem == floatNaN {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseFloat64NaN(input string) (float64, error) {
+	const parseableNaN = "NaN"
+
+	if input == "NA" {
+		return strconv.ParseFloat(parseableNaN, 64)
+	} else {
+		return strconv.ParseFloat(input, 64)
+	}
+}
+
+// Flip the sign of a number while keeping its original string formatting.
+func flipSign(number string) string {
+	if number == "NA" {
+		return number
+	}
+
+	if strings.HasPrefix(number, "-") {
+		return strings.TrimPrefix(number, "-")
+	} else {
+		return "-" + strings.TrimPrefix(number, "+")
+	}
+}
+
+// Parse a size in bytes, with an optional K, M, G or T suffix (powers of 1024).
+func parseByteSize(size string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.ToUpper(size)
+	for ii, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(number, suffix) {
+			multiplier = int64(1) << (10 * (ii + 1))
+			number = strings.TrimSuffix(number, suffix)
+		}
+	}
+
+	parsed, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if parsed <= 0 {
+		return 0, fmt.Errorf("size must be positive, got %s", size)
+	}
+	return parsed * multiplier, nil
+}
+
+func formatFloat(number float64) string {
+	var withDecimalExponent byte = 'e'
+	precisionExactSmallest := -1
+
+	return strconv.FormatFloat(number, withDecimalExponent, precisionExactSmallest, 64)
+}
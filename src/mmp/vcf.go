@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"bufio"
+	"strings"
+)
+
+// VCF lines can be long when they have many INFO fields or samples.
+const maxVcfLineSize = 64 * 1024 * 1024
+
+const vcfMissingValue = "."
+
+// Stream the requested columns of a VCF file, such as a GWAS-VCF file.
+//
+// A requested column is looked up, in this order, in:
+// 1. the VCF columns (#CHROM, POS, REF, ALT, ...)
+// 2. the INFO keys
+// 3. the FORMAT keys, taking the value of the first sample
+func (runner *Runner) streamVcf(filepath string, compressionType string, columns []string, rowChannel chan<- []string) {
+	dataReader, closeFile := runner.openDecompressed(filepath, compressionType)
+	defer closeFile()
+
+	scanner := bufio.NewScanner(dataReader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxVcfLineSize)
+
+	// Keep track of the declared INFO and FORMAT keys in the meta-information
+	// lines, and of the VCF header.
+	infoKeys := make(map[string]bool)
+	formatKeys := make(map[string]bool)
+	var header []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "##INFO=<ID=") {
+			infoKeys[vcfMetaID(line, "##INFO=<ID=")] = true
+		} else if strings.HasPrefix(line, "##FORMAT=<ID=") {
+			formatKeys[vcfMetaID(line, "##FORMAT=<ID=")] = true
+		} else if !strings.HasPrefix(line, "##") {
+			header = strings.Split(line, "\t")
+			break
+		}
+	}
+	logCheck("parsing VCF header", scanner.Err())
+	if header == nil {
+		fail("Could not find the #CHROM header line in VCF file `", filepath, "`.")
+	}
+
+	headerToIndex := make(map[string]int)
+	for ii, headerColumn := range header {
+		headerToIndex[headerColumn] = ii
+	}
+	idxInfo, hasInfo := headerToIndex["INFO"]
+	idxFormat, hasFormat := headerToIndex["FORMAT"]
+	hasSample := hasFormat && len(header) > idxFormat+1
+
+	for _, requestedColumn := range columns {
+		_, isColumn := headerToIndex[requestedColumn]
+		isInfo := hasInfo && infoKeys[requestedColumn]
+		isFormat := hasSample && formatKeys[requestedColumn]
+		if !isColumn && !isInfo && !isFormat {
+			fail("Could not find column, INFO key nor FORMAT key `", requestedColumn, "` in VCF file `", filepath, "`. Header: ", header)
+		}
+	}
+
+	// Emit the rows over the channel, up to --head rows
+	var nRows int64
+	for ; (runner.HeadRows == 0 || nRows < runner.HeadRows) && scanner.Scan(); nRows++ {
+		runner.readersMemory.wait(nRows)
+
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != len(header) {
+			fail("VCF row has ", len(fields), " fields but the header has ", len(header), " in file `", filepath, "`.")
+		}
+
+		var infoValues map[string]string
+		if hasInfo {
+			infoValues = parseVcfInfo(fields[idxInfo])
+		}
+		var sampleValues map[string]string
+		if hasSample {
+			sampleValues = parseVcfSample(fields[idxFormat], fields[idxFormat+1])
+		}
+
+		rowFromColumns := make([]string, len(columns))
+		for ii, requestedColumn := range columns {
+			value := vcfMissingValue
+			if idxColumn, found := headerToIndex[requestedColumn]; found {
+				value = fields[idxColumn]
+			} else if infoValue, found := infoValues[requestedColumn]; found {
+				value = infoValue
+			} else if sampleValue, found := sampleValues[requestedColumn]; found {
+				value = sampleValue
+			}
+
+			if value == vcfMissingValue {
+				value = outputDefaultMissingValue
+			}
+			rowFromColumns[ii] = value
+		}
+
+		if !send(runner, rowChannel, rowFromColumns) {
+			return
+		}
+	}
+	logCheck("parsing VCF row", scanner.Err())
+}
+
+func vcfMetaID(line string, prefix string) string {
+	id := strings.TrimPrefix(line, prefix)
+	if end := strings.IndexAny(id, ",>"); end != -1 {
+		id = id[:end]
+	}
+	return id
+}
+
+// Parse "KEY1=value1;KEY2=value2;FLAG" INFO fields. Flags have no value and are skipped.
+func parseVcfInfo(info string) map[string]string {
+	infoValues := make(map[string]string)
+	for _, keyValue := range strings.Split(info, ";") {
+		key, value, found := strings.Cut(keyValue, "=")
+		if found {
+			infoValues[key] = value
+		}
+	}
+	return infoValues
+}
+
+// Parse the "KEY1:KEY2" FORMAT and "value1:value2" sample fields.
+func parseVcfSample(format string, sample string) map[string]string {
+	sampleValues := make(map[string]string)
+	keys := strings.Split(format, ":")
+	values := strings.Split(sample, ":")
+	for ii, key := range keys {
+		// Trailing sample values can be dropped in VCF.
+		if ii < len(values) {
+			sampleValues[key] = values[ii]
+		}
+	}
+	return sampleValues
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: MIT
+package mmp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/FINNGEN/mmpio/meta"
+)
+
+// FORMAT fields of the GWAS-VCF specification written for each sample
+var vcfFormatFields = []string{"ES", "SE", "LP", "AF", "SS"}
+
+var vcfFormatHeaders = []string{
+	`##FORMAT=<ID=ES,Number=A,Type=Float,Description="Effect size estimate relative to the alternative allele">`,
+	`##FORMAT=<ID=SE,Number=A,Type=Float,Description="Standard error of effect size estimate">`,
+	`##FORMAT=<ID=LP,Number=A,Type=Float,Description="-log10 p-value for effect estimate">`,
+	`##FORMAT=<ID=AF,Number=A,Type=Float,Description="Alternate allele frequency in the association study">`,
+	`##FORMAT=<ID=SS,Number=A,Type=Float,Description="Sample size used to estimate genetic effect">`,
+}
+
+// Write the output variants as a GWAS-VCF. As in the GWAS-VCF specification,
+// each study is a sample column with its stats as FORMAT fields: first the
+// inputs, then the heterogeneity tests with their meta-analysis. Tests
+// combining p-values only have an LP.
+func (runner *Runner) writeVcfOutput(conf Conf, combinedStatsVariants map[CPRA][]OutputStats) {
+	var samples []string
+	for _, inputConf := range conf.Inputs {
+		samples = append(samples, inputConf.Tag)
+	}
+	for _, test := range conf.HeterogeneityTests {
+		if contains(samples, test.Tag) {
+			fail("The heterogeneity test `", test.Tag, "` has the tag of an input, so they can't be told apart in the VCF output.")
+		}
+		samples = append(samples, test.Tag)
+	}
+
+	outWriter, closeOutput := runner.createCompressed(runner.VcfOutputPath)
+	defer closeOutput()
+
+	version := runner.Version
+	if version == "" {
+		version = "unknown"
+	}
+	headerLines := []string{
+		"##fileformat=VCFv4.2",
+		"##source=mmpio " + version,
+	}
+	headerLines = append(headerLines, vcfFormatHeaders...)
+	for _, inputConf := range conf.Inputs {
+		headerLines = append(headerLines, fmt.Sprintf(`##SAMPLE=<ID=%s,StudyType=Input>`, inputConf.Tag))
+	}
+	for _, test := range conf.HeterogeneityTests {
+		headerLines = append(headerLines, fmt.Sprintf(`##SAMPLE=<ID=%s,StudyType=MetaAnalysis,Studies="%s">`, test.Tag, strings.Join(test.Compare, ",")))
+	}
+	columns := append([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT"}, samples...)
+	headerLines = append(headerLines, strings.Join(columns, "\t"))
+	writeVcfLine(outWriter, strings.Join(headerLines, "\n"))
+
+	format := strings.Join(vcfFormatFields, ":")
+	runner.streamVariantResults(conf, combinedStatsVariants, func(cpra CPRA, multipleStats []OutputStats, metaResults map[string]meta.MetaResult) {
+		fields := []string{cpra.Chrom, cpra.Pos, vcfMissingValue, cpra.Ref, cpra.Alt, vcfMissingValue, "PASS", vcfMissingValue, format}
+
+		for _, inputConf := range conf.Inputs {
+			sample := []string{vcfMissingValue, vcfMissingValue, vcfMissingValue, vcfMissingValue, vcfMissingValue}
+			for _, stats := range multipleStats {
+				if stats.Tag != inputConf.Tag {
+					continue
+				}
+				sample = []string{
+					vcfValue(stats.Beta),
+					vcfValue(stats.SEBeta),
+					vcfValue(runner.formatNegLog10P(stats.PVal, "")),
+					vcfValue(stats.AF),
+					vcfValue(stats.N),
+				}
+			}
+			fields = append(fields, strings.Join(sample, ":"))
+		}
+
+		for _, test := range conf.HeterogeneityTests {
+			sample := []string{vcfMissingValue, vcfMissingValue, vcfMissingValue, vcfMissingValue, vcfMissingValue}
+			multipleTestStats := testStats(test, cpra, combinedStatsVariants, conf.Inputs)
+			_, tagsWithDirection, tagsWithPVal := TagsWithStats(multipleTestStats)
+			studies := runner.testStudies(test, multipleTestStats, conf.Inputs)
+			if metaResult, found := metaResults[test.Tag]; found {
+				sample[0] = formatFloat(metaResult.Beta)
+				sample[1] = formatFloat(metaResult.SEBeta)
+				sample[2] = formatFloat(metaResult.NegLog10PVal)
+			} else if pval, found := combinedPVal(test, studies, tagsWithDirection, tagsWithPVal); found {
+				sample[2] = formatFloat(meta.NegLog10(runner.floorZeroPVal(pval)))
+			}
+			if sample[2] != vcfMissingValue && testHasSampleSize(test, conf.Inputs) {
+				sample[4] = vcfValue(formatMetaSampleSize(studies))
+			}
+			fields = append(fields, strings.Join(sample, ":"))
+		}
+
+		writeVcfLine(outWriter, strings.Join(fields, "\t"))
+	})
+}
+
+func writeVcfLine(outWriter io.Writer, line string) {
+	_, err := io.WriteString(outWriter, line+"\n")
+	logCheck("writing VCF output", err)
+}
+
+func vcfValue(value string) string {
+	if value == outputDefaultMissingValue {
+		return vcfMissingValue
+	}
+	return value
+}
@@ -2,150 +2,133 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"sync"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/FINNGEN/mmpio/mmp"
 )
 
-const outputDefaultMissingValue = "NA"
+// Get the program version from git.
+// This should be passed as a build time variable, for example:
+// go build -ldflags "-X main.MMPioVersion=$(git describe --tags)"
+var MMPioVersion string
 
+// The command line only sets the options of the run, the run itself is done
+// by the mmp package.
 func main() {
-	cliInit()
-	conf := readConf(configPath)
-
-	fmt.Println("[1/4] Scanning input files for variant selection...")
-	selectedVariants := scanForVariantSelection(conf)
-
-	fmt.Println("[2/4] Finding variant statistics based on the variant selection...")
-	variantStats := findVariantStats(conf, selectedVariants)
-
-	fmt.Println("[3/4] Combining finemapping statistics...")
-	combineFinemapping(conf, variantStats)
-
-	fmt.Printf("[4/4] Computing heterogeneity tests & writing output to %s ...\n", outputPath)
-	writeMMPOutput(conf, variantStats)
-}
-
-func scanForVariantSelection(conf Conf) map[CPRA]bool {
-	selectedVariants := make(map[CPRA]bool)
-
-	var wg sync.WaitGroup
-	cpraChannel := make(chan CPRA)
-
-	for _, inputConf := range conf.Inputs {
-		wg.Add(1)
-		go func(inputConf InputConf) {
-			defer wg.Done()
-			streamVariantsAboveThreshold(inputConf, cpraChannel)
-		}(inputConf)
-	}
-
-	go func() {
-		wg.Wait()
-		close(cpraChannel)
-	}()
-
-	for cpra := range cpraChannel {
-		selectedVariants[cpra] = true
+	runOptions := mmp.DefaultOptions()
+	runOptions.Version = MMPioVersion
+
+	var outputMode string
+	var seed uint64
+	var printConfig bool
+	var printFingerprint bool
+	var showVersion bool
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s (%s):\n", os.Args[0], MMPioVersion)
+		flag.PrintDefaults()
 	}
-
-	return selectedVariants
-}
-
-func findVariantStats(conf Conf, selectedVariants map[CPRA]bool) map[CPRA][]OutputStats {
-	variantMultipleStats := make(map[CPRA][]OutputStats)
-
-	var wg sync.WaitGroup
-	selectedRowChannel := make(chan InputSummaryStatsRow)
-
-	for _, inputConf := range conf.Inputs {
-		wg.Add(1)
-		go func(inputConf InputConf) {
-			defer wg.Done()
-			streamRowsFromSelection(inputConf, selectedVariants, selectedRowChannel)
-		}(inputConf)
+	flag.StringVar(&runOptions.ConfigPath, "config", runOptions.ConfigPath, "Specify the configuration path or http(s):// URL (JSON)")
+	flag.BoolVar(&runOptions.FailFast, "fail-fast", runOptions.FailFast, "Stop at the first error of the configuration file, use --fail-fast=false to report all of them at once")
+	flag.BoolVar(&runOptions.StrictConfig, "strict-config", runOptions.StrictConfig, "Stop with an error on unknown keys in the configuration file, for example a misspelled column key")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the configuration as it will be run, with the defaults filled in, as JSON and exit")
+	flag.BoolVar(&printFingerprint, "fingerprint", false, "Print a SHA-256 of the configuration, the options and the size and modification time of the input files, identifying the run, and exit")
+	flag.StringVar(&runOptions.OutputPath, "output", runOptions.OutputPath, "Specify the output path (TSV)")
+	flag.StringVar(&runOptions.RejectedLogPath, "rejected-log", runOptions.RejectedLogPath, "Write the variants dropped from each input, with the reason why, to this path (TSV)")
+	flag.StringVar(&runOptions.SelectedBedPath, "selected-bed", runOptions.SelectedBedPath, "Also write the selected variant positions to this path (BED)")
+	flag.StringVar(&runOptions.SaveSelectionPath, "save-selection", runOptions.SaveSelectionPath, "Also write the selected variants to this path, to skip the variant selection of later runs with --selection")
+	flag.StringVar(&runOptions.SelectionPath, "selection", runOptions.SelectionPath, "Read the selected variants from a file written by --save-selection instead of scanning the inputs for them")
+	flag.StringVar(&runOptions.ReportPath, "report", runOptions.ReportPath, "Write a run report with a QC summary of each input to this path (JSON)")
+	flag.StringVar(&runOptions.VcfOutputPath, "vcf-output", runOptions.VcfOutputPath, "Also write the stats of the inputs and the meta-analyses for the output variants to this path as a GWAS-VCF, gzip-compressed with a .gz extension")
+	flag.StringVar(&runOptions.ManhattanPath, "manhattan-output", runOptions.ManhattanPath, "Also write the -log10(p) of each input for the output variants to this path, one row per input and variant (TSV)")
+	flag.StringVar(&runOptions.DumpStatsPath, "dump-stats", runOptions.DumpStatsPath, "Also write the parsed stats of each input for the output variants to this path, before the meta-analysis, one row per variant and input (TSV)")
+	flag.StringVar(&runOptions.GenesPath, "genes", runOptions.GenesPath, "Add the nearest gene of each output variant and its distance, from the genes of this BED or GTF file (.gtf or .gtf.gz)")
+
+	flag.StringVar(&runOptions.SelectionScope, "selection-scope", runOptions.SelectionScope, "Select variants from all inputs (all), from inputs in heterogeneity tests (tests), or from inputs of the given heterogeneity test tag")
+	flag.BoolVar(&runOptions.FailOnEmptySelection, "fail-on-empty-selection", runOptions.FailOnEmptySelection, "Exit with an error instead of a warning when no variant passes the selection")
+	flag.BoolVar(&runOptions.OutputNegLog10P, "neglog10p", runOptions.OutputNegLog10P, "Also output -log10(p) and signed -log10(p) columns for each input")
+	flag.BoolVar(&runOptions.OutputAFMean, "af-mean", runOptions.OutputAFMean, "Also output the mean AF of each variant across the inputs, weighted by sample size when all the inputs have one")
+	flag.BoolVar(&runOptions.OutputPresentMask, "present-mask", runOptions.OutputPresentMask, "Also output a present_mask column with one character per input, 1 when it has stats for the variant and 0 otherwise")
+	flag.BoolVar(&runOptions.SelfCheck, "self-check", runOptions.SelfCheck, "Check for a sample of the output variants that the input and meta betas are aligned to the variant alleles, by reading the inputs once more, and stop with an error on any mismatch")
+	flag.Float64Var(&runOptions.I2FlagThreshold, "i2-flag-threshold", runOptions.I2FlagThreshold, "Set the heterogeneity flag of a meta-analysis when its I² is above this value")
+	flag.Float64Var(&runOptions.ZeroPValFloor, "zero-pval-floor", runOptions.ZeroPValFloor, "Replace the input p-values of 0 by this value when computing -log10 p-values and combined p-values, so that they stay finite")
+	flag.Int64Var(&runOptions.ClumpWindow, "clump-window", runOptions.ClumpWindow, "Only keep the most significant variant within this distance (in bp). Disabled when 0.")
+	flag.StringVar(&runOptions.ClumpBy, "clump-by", runOptions.ClumpBy, "Input tag whose p-value drives the clumping, or min for the minimum p-value across inputs")
+
+	flag.BoolVar(&runOptions.AutosomesOnly, "autosomes-only", runOptions.AutosomesOnly, "Only keep the variants on chromosomes 1 to 22 in all the inputs, as `autosomes_only` does for a single input")
+	flag.BoolVar(&runOptions.NoFinemap, "no-finemap", runOptions.NoFinemap, "Skip the finemapping files and leave the pip and cs columns out of the output")
+	flag.Float64Var(&runOptions.MaxUnmatchedFinemap, "max-unmatched-finemap", runOptions.MaxUnmatchedFinemap, "Stop with an error when the fraction of finemap rows of an input without a matching selected variant is above this value")
+	flag.StringVar(&runOptions.ColumnGroups, "column-groups", runOptions.ColumnGroups, "Order of the column groups in the output: variant (cpra), per-input (inputs) and heterogeneity test (meta) columns")
+	flag.BoolVar(&runOptions.LongOutput, "long", runOptions.LongOutput, "Output one row per variant and input, with the meta columns repeated on each row")
+	flag.BoolVar(&runOptions.SplitByTest, "split-by-test", runOptions.SplitByTest, "Write the output of each heterogeneity test to its own file, with only the columns of its inputs, instead of a single output")
+	flag.BoolVar(&runOptions.MetaHits, "meta-hits", runOptions.MetaHits, "Only output the variants with a meta p-value below 5e-8 in at least one heterogeneity test, with the variant and meta columns only")
+	flag.BoolVar(&runOptions.EmitSchema, "emit-schema", runOptions.EmitSchema, "Also write a JSON description of the output columns next to the TSV output, for example out.schema.json for out.tsv.gz")
+	flag.BoolVar(&runOptions.HeaderComment, "header-comment", runOptions.HeaderComment, "Start the TSV output with a # comment line with the mmpio version, the command line and the configuration path and SHA-256")
+	flag.BoolVar(&runOptions.MetadataHeader, "metadata-header", runOptions.MetadataHeader, "Start the TSV output with # comment lines with the metadata of the inputs")
+	flag.BoolVar(&runOptions.StatMajor, "stat-major", runOptions.StatMajor, "Group the per-input and meta columns by statistic (all p-values, then all betas...) instead of by input and test")
+
+	flag.StringVar(&runOptions.LineTerminator, "line-terminator", runOptions.LineTerminator, "Line terminator of the TSV outputs: lf (\\n) or crlf (\\r\\n)")
+	flag.BoolVar(&runOptions.NoTrailingNewline, "no-trailing-newline", runOptions.NoTrailingNewline, "Leave out the line terminator after the last line of the TSV outputs")
+	flag.IntVar(&runOptions.GzipLevel, "gzip-level", runOptions.GzipLevel, "Compression level, from 1 (fastest) to 9 (smallest), of outputs with a .gz extension")
+	flag.StringVar(&outputMode, "output-mode", "", "Permissions of the output files, in octal, by default 0666 minus the umask")
+
+	flag.Int64Var(&runOptions.MaxSelected, "max-selected", runOptions.MaxSelected, "Stop with an error if more than N variants are selected, 0 for no limit")
+	flag.BoolVar(&runOptions.TruncateSelected, "truncate-selected", runOptions.TruncateSelected, "With --max-selected, keep the N selected variants with the smallest p-values, with a warning, instead of stopping")
+	flag.Int64Var(&runOptions.HeadRows, "head", runOptions.HeadRows, "Only read the first N data rows of each data file, so N rows per file for an input given as a manifest, for a quick check of the configuration")
+	flag.StringVar(&runOptions.MaxMemory, "max-memory", runOptions.MaxMemory, "Soft memory limit, for example 8G or 512M: when approaching it, the garbage collector works harder and the reading of the inputs pauses to let it free memory. The memory use still goes over it when the selected variants need more.")
+	flag.DurationVar(&runOptions.ProgressInterval, "progress", runOptions.ProgressInterval, "Report the progress of reading the input files at this interval, for example 30s, with the percentage read and an estimate of their number of rows")
+
+	flag.Uint64Var(&seed, "seed", 0, "Reserved: seed of the source of randomness of the statistical methods, for reproducible results. The current methods are deterministic, so it has no effect yet.")
+	flag.BoolVar(&showVersion, "version", false, "Show MMP::io version")
+	flag.Parse()
+
+	if showVersion {
+		fmt.Fprintf(flag.CommandLine.Output(), "%s\n", MMPioVersion)
+		os.Exit(0)
 	}
 
-	go func() {
-		wg.Wait()
-		close(selectedRowChannel)
-	}()
-
-	for parsedRow := range selectedRowChannel {
-		outputStats := OutputStats{
-			Tag:    parsedRow.Tag,
-			PVal:   parsedRow.PVal,
-			Beta:   parsedRow.Beta,
-			SEBeta: parsedRow.SEBeta,
-			AF:     parsedRow.AF,
-
-			// These will be eventually filled with the finemapping values,
-			// if a finemapping file was provided for this input.
-			PIP: outputDefaultMissingValue,
-			CS:  outputDefaultMissingValue,
+	flag.Visit(func(setFlag *flag.Flag) {
+		if setFlag.Name == "seed" {
+			runOptions.Seed = &seed
 		}
-
-		multipleOutputStats, found := variantMultipleStats[parsedRow.CPRA]
-		if !found {
-			var multipleOutputStats = []OutputStats{outputStats}
-			variantMultipleStats[parsedRow.CPRA] = multipleOutputStats
-		} else {
-			multipleOutputStats = append(multipleOutputStats, outputStats)
-			variantMultipleStats[parsedRow.CPRA] = multipleOutputStats
+	})
+	if outputMode != "" {
+		mode, err := strconv.ParseUint(outputMode, 8, 32)
+		if err != nil || mode > 0777 {
+			log.Fatal("Invalid --output-mode `", outputMode, "`. It must be octal permissions, for example 0644.")
 		}
+		fileMode := os.FileMode(mode)
+		runOptions.OutputMode = &fileMode
 	}
 
-	return variantMultipleStats
-}
-
-func combineFinemapping(conf Conf, variantStats map[CPRA][]OutputStats) {
-	// We need this:
-	// Tag => CPRA => InputFinemapRow
-	// that is gathered by reading the finemap files
-	//
-	// Then we iterate over variantStats,
-	// for each CPRA,
-	// we look at each Tag,
-	// and if there is  Tag => CPRA  match in the above, then we add
-	// the finemap stats.
-	finemapStatsGathering := make(map[string]map[CPRA]InputFinemapRow)
-
-	var wg sync.WaitGroup
-	finemapRowChannel := make(chan InputFinemapRow)
-
-	for _, inputConf := range conf.Inputs {
-		if inputConf.FinemapFilepath != "" {
-			wg.Add(1)
-			go func(inputConf InputConf) {
-				defer wg.Done()
-				streamFinemapFile(inputConf, finemapRowChannel)
-			}(inputConf)
+	runner, err := mmp.Configure(runOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf, err := runner.ReadConf(runOptions.ConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printConfig {
+		if err := mmp.PrintEffectiveConf(conf); err != nil {
+			log.Fatal(err)
 		}
+		os.Exit(0)
 	}
-
-	go func() {
-		wg.Wait()
-		close(finemapRowChannel)
-	}()
-
-	for finemapRow := range finemapRowChannel {
-		tagData, found := finemapStatsGathering[finemapRow.Tag]
-		if !found {
-			tagData = make(map[CPRA]InputFinemapRow)
+	if printFingerprint {
+		fingerprint, err := runner.Fingerprint(conf)
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		tagData[finemapRow.CPRA] = finemapRow
-		finemapStatsGathering[finemapRow.Tag] = tagData
+		fmt.Println(fingerprint)
+		os.Exit(0)
 	}
 
-	// Now time to combine with variantStats
-	for cpra, multipleOutputStats := range variantStats {
-		for idxTag, outputStats := range multipleOutputStats {
-			if _, tagFound := finemapStatsGathering[outputStats.Tag]; tagFound {
-				if finemapStats, cpraFound := finemapStatsGathering[outputStats.Tag][cpra]; cpraFound {
-					variantStats[cpra][idxTag].PIP = finemapStats.PIP
-					variantStats[cpra][idxTag].CS = finemapStats.CS
-				}
-			}
-		}
+	if err := runner.Run(conf); err != nil {
+		log.Fatal(err)
 	}
 }
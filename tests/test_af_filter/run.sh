@@ -0,0 +1,18 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+
+# Variants with an AF outside of [min_af, max_af] are dropped, the ones with a
+# missing AF are kept, and an AF outside of [0, 1] is reported
+../../mmpio --config config.json --output data_out.tsv 2> data_out_warning.log
+diff data_expected.tsv data_out.tsv
+grep "WARNING: 1 variants have an AF outside of \[0, 1\] in input \`Dataset1\`" data_out_warning.log
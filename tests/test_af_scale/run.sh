@@ -0,0 +1,23 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_fraction.tsv | gzip > data_sumstats_fraction.tsv.gz
+cat data_sumstats_percent.tsv | gzip > data_sumstats_percent.tsv.gz
+cat data_sumstats_maf.tsv | gzip > data_sumstats_maf.tsv.gz
+
+# Run end-to-end test: percentages are turned into fractions, and minor
+# allele frequencies are left out of the mean AF
+../../mmpio --config config.json --output data_out.tsv --af-mean
+diff data_expected.tsv data_out.tsv
+
+# Percentages read as fractions are reported
+sed 's/"af_scale": "percent"/"af_scale": "fraction"/' config.json > data_out_config_fraction.json
+../../mmpio --config data_out_config_fraction.json --output data_out_fraction.tsv 2>&1 | grep "WARNING: 2 variants have an AF outside of \[0, 1\] in input \`Percent\`"
@@ -0,0 +1,22 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# Dataset2 has the variant at 1:100 with its alleles swapped and the one at
+# 1:200 on the other strand, so their stats are not combined and reported.
+# The different alt alleles at 1:300 are distinct variants.
+../../mmpio --config config.json --output data_out.tsv 2> data_out_warning.log
+diff data_expected.tsv data_out.tsv
+grep "WARNING: 2 variants have alleles swapped or on the other strand" data_out_warning.log
+grep "^- " data_out_warning.log > data_out_warning.txt
+diff data_expected_warning.txt data_out_warning.txt
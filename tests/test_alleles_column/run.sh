@@ -0,0 +1,23 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_ref_alt.tsv | gzip > data_sumstats_ref_alt.tsv.gz
+cat data_sumstats_slash.tsv | gzip > data_sumstats_slash.tsv.gz
+cat data_sumstats_alt_first.tsv | gzip > data_sumstats_alt_first.tsv.gz
+cat data_sumstats_invalid.tsv | gzip > data_sumstats_invalid.tsv.gz
+
+# Run end-to-end test
+../../mmpio --config config.json --output data_out.tsv
+
+diff data_expected.tsv data_out.tsv
+
+# Alleles column without exactly 2 alleles
+! ../../mmpio --config config_invalid.json --output data_out_invalid.tsv
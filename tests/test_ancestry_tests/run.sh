@@ -0,0 +1,20 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+cat data_sumstats_dataset3.tsv | gzip > data_sumstats_dataset3.tsv.gz
+
+# Run end-to-end test: a test of the EUR inputs and one of all the inputs,
+# the single EAS input has no test
+../../mmpio --config config.json --output data_out.tsv 2>&1 | grep "WARNING: ancestry \`EAS\` has a single input"
+
+diff data_expected.tsv data_out.tsv
@@ -0,0 +1,27 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_A.tsv | gzip > data_sumstats_A.tsv.gz
+cat data_sumstats_B.tsv | gzip > data_sumstats_B.tsv.gz
+
+# Two variants within the window, the lead being the one with the minimum
+# p-value across the inputs, and a third one outside of the window
+../../mmpio --config config.json --output data_out.tsv --clump-window 1000
+diff data_expected.tsv data_out.tsv
+
+# The lead is the most significant variant in input A only
+../../mmpio --config config.json --output data_out_clump_by.tsv --clump-window 1000 --clump-by A
+diff data_expected_clump_by.tsv data_out_clump_by.tsv
+
+# An unknown tag is a configuration error, reported before scanning the inputs
+! ../../mmpio --config config.json --output data_out_unknown.tsv --clump-window 1000 --clump-by C > data_out_unknown.log 2>&1
+grep "Could not clump by \`C\`" data_out_unknown.log
+test $(grep -c "1/4" data_out_unknown.log) -eq 0
@@ -0,0 +1,17 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats.tsv | gzip > data_sumstats.tsv.gz
+
+# Configuration with line and block comments, trailing commas, and comment
+# markers and escaped quotes inside strings, which are kept
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
@@ -0,0 +1,28 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+# All the configuration errors are reported at once, without the log timestamps
+! ../../mmpio --config config.json --output data_out.tsv --fail-fast=false 2> data_out_errors_raw.txt
+sed -E 's/^[0-9/]+ [0-9:]+ //' data_out_errors_raw.txt > data_out_errors.txt
+
+diff data_expected_errors.txt data_out_errors.txt
+
+# By default only the first one
+! ../../mmpio --config config.json --output data_out.tsv 2> data_out_first_error_raw.txt
+sed -E 's/^[0-9/]+ [0-9:]+ //' data_out_first_error_raw.txt > data_out_first_error.txt
+
+diff data_expected_first_error.txt data_out_first_error.txt
+
+# Unknown keys with --strict-config, with a hint at the most likely key
+! ../../mmpio --config config_typo.json --output data_out.tsv --strict-config 2> data_out_typo_raw.txt
+sed -E 's/^[0-9/]+ [0-9:]+ //' data_out_typo_raw.txt > data_out_typo.txt
+
+diff data_expected_typo.txt data_out_typo.txt
@@ -0,0 +1,21 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_duplicates.tsv | gzip > data_sumstats_duplicates.tsv.gz
+
+# By default the duplicate row with the smallest p-value is kept
+../../mmpio --config config.json --output data_out.tsv 2>&1 | grep "WARNING: 3 duplicate rows"
+
+diff data_expected.tsv data_out.tsv
+
+../../mmpio --config config_last.json --output data_out_last.tsv
+
+diff data_expected_last.tsv data_out_last.tsv
@@ -0,0 +1,21 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# The beta and sebeta of Dataset2 are doubled before the meta-analysis
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# The factor must be positive, flipping the sign is done with `flip_beta`
+! ../../mmpio --config config_negative.json --output data_out_negative.tsv 2> data_out_negative.log
+grep "Input \`Dataset2\` has a negative \`effect_scale_factor\`. It must be a positive number, use \`flip_beta\` to flip the sign of beta." data_out_negative.log
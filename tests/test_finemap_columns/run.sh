@@ -0,0 +1,22 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+
+# PIP and CS are read from columns of the summary stats file, without a
+# finemap file
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# Finemapping comes from the summary stats columns or from a finemap file, not both
+sed 's/"finemap_filepath": null/"finemap_filepath": "data_finemap.tsv"/' config.json > data_out_config_both.json
+! ../../mmpio --config data_out_config_both.json --output data_out_both.tsv 2> data_out_both.log
+grep "Input \`Dataset1\` has both \`col_pip\`/\`col_cs\` and \`finemap_filepath\`" data_out_both.log
@@ -0,0 +1,23 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+
+# Finemap variants like chrom_pos_ref_alt, with "finemap_cpra_separator": "_"
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# With the default separator, the first finemap row is rejected before the
+# summary stats are scanned
+sed '/"finemap_cpra_separator"/d' config.json > data_out_config_default.json
+! ../../mmpio --config data_out_config_default.json --output data_out_default.tsv > data_out_default.log 2>&1
+grep "Could not parse CPRA from value \`1_100_A_G\` using separator \`:\`" data_out_default.log
+test $(grep -c "1/4" data_out_default.log) -eq 0
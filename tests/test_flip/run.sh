@@ -0,0 +1,22 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# Dataset2 has `flip_beta` and `flip_af`: its beta is negated and its AF is
+# replaced by 1 - AF before `max_af`, which drops 1:100 (AF 0.31 -> 0.69)
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# A minor allele frequency can't be flipped
+! ../../mmpio --config config_maf.json --output data_out_maf.tsv 2> data_out_maf.log
+grep "Input \`Dataset2\` has both \`af_is_maf\` and \`flip_af\`" data_out_maf.log
@@ -0,0 +1,47 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+cat data_sumstats_dataset3.tsv | gzip > data_sumstats_dataset3.tsv.gz
+
+
+# Run end-to-end test
+
+../../mmpio --config config.json --output data_out.tsv --manhattan-output data_out_manhattan.tsv --report data_out_report.json --dump-stats data_out_stats.tsv
+
+diff data_expected.tsv data_out.tsv
+diff data_expected_manhattan.tsv data_out_manhattan.tsv
+diff data_expected_report.json data_out_report.json
+diff data_expected_stats.tsv data_out_stats.tsv
+
+# Same output with another column layout
+../../mmpio --config config.json --output data_out_stat_major.tsv --column-groups cpra,meta,inputs --stat-major --af-mean --present-mask --emit-schema
+diff data_expected_stat_major.tsv data_out_stat_major.tsv
+diff data_expected_stat_major.schema.json data_out_stat_major.schema.json
+
+# One row per variant and input
+../../mmpio --config config.json --output data_out_long.tsv --long --emit-schema
+diff data_expected_long.tsv data_out_long.tsv
+diff data_expected_long.schema.json data_out_long.schema.json
+
+# One output per heterogeneity test
+../../mmpio --config config.json --output data_out_split.tsv --split-by-test
+diff data_expected_split.meta1.tsv data_out_split.meta1.tsv
+diff data_expected_split.meta2.tsv data_out_split.meta2.tsv
+
+# Only the genome-wide significant meta results, with the provenance and input metadata as comments
+../../mmpio --config config.json --output data_out_meta_hits.tsv --meta-hits --header-comment --metadata-header
+diff data_expected_meta_hits.tsv data_out_meta_hits.tsv
+
+# GWAS-VCF output of the inputs and the meta-analyses
+../../mmpio --config config.json --output data_out.tsv --vcf-output data_out.vcf
+diff data_expected.vcf data_out.vcf
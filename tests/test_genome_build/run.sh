@@ -0,0 +1,24 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# Inputs on the same genome build are compared
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# Inputs on different genome builds in the same heterogeneity test stop MMP::io
+# before reading them
+sed '0,/"GRCh38"/s//"GRCh37"/' config.json > data_out_config_mismatch.json
+! ../../mmpio --config data_out_config_mismatch.json --output data_out_mismatch.tsv 2> data_out_mismatch.log
+grep "Heterogeneity test \`meta1\` compares inputs on different genome builds: \`Dataset1\` is on \`GRCh37\` but \`Dataset2\` is on \`GRCh38\`" data_out_mismatch.log
+test ! -e data_out_mismatch.tsv
@@ -0,0 +1,26 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# The compression level is recorded in the extra flags of the gzip header:
+# 4 for the fastest level and 2 for the smallest
+../../mmpio --config config.json --output data_out_fast.tsv.gz --gzip-level 1
+zcat data_out_fast.tsv.gz | diff data_expected.tsv -
+[ "$(od -An -tu1 -j8 -N1 data_out_fast.tsv.gz | tr -d ' ')" = "4" ]
+
+../../mmpio --config config.json --output data_out_small.tsv.gz --gzip-level 9
+zcat data_out_small.tsv.gz | diff data_expected.tsv -
+[ "$(od -An -tu1 -j8 -N1 data_out_small.tsv.gz | tr -d ' ')" = "2" ]
+
+! ../../mmpio --config config.json --output data_out_invalid.tsv.gz --gzip-level 0 2> data_out_invalid.log
+grep "Invalid --gzip-level 0. It must be between 1 and 9." data_out_invalid.log
@@ -0,0 +1,27 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+# Two gzip members, as from a concatenation, followed by bytes that are not gzip
+(head -n 3 data_sumstats.tsv | gzip; tail -n +4 data_sumstats.tsv | gzip; printf 'not gzip data\0\0\0\0') > data_sumstats.tsv.gz
+
+# Run end-to-end test
+../../mmpio --config config.json --output data_out.tsv 2>&1 | grep "WARNING: ignoring the trailing bytes after the last gzip member of \`data_sumstats.tsv.gz\`"
+diff data_expected.tsv data_out.tsv
+
+# Zero padding shorter than a gzip header is ignored as well
+(cat data_sumstats.tsv | gzip; printf '\0\0\0') > data_sumstats.tsv.gz
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# A truncated file stops with the number of lines read before its end
+cat data_sumstats.tsv | gzip | head -c -12 > data_sumstats.tsv.gz
+! ../../mmpio --config config.json --output data_out.tsv 2> data_out_truncated.log
+grep "Could not read the gzip file \`data_sumstats.tsv.gz\` after [0-9]* lines, it is truncated" data_out_truncated.log
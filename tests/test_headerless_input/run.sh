@@ -0,0 +1,30 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_header.tsv | gzip > data_sumstats_header.tsv.gz
+cat data_sumstats_headerless.tsv | gzip > data_sumstats_headerless.tsv.gz
+
+# Run end-to-end test
+../../mmpio --config config.json --output data_out.tsv
+
+diff data_expected.tsv data_out.tsv
+
+# Progress reporting doesn't change the output
+../../mmpio --config config.json --output data_out_progress.tsv --progress 1ms
+diff data_expected.tsv data_out_progress.tsv
+
+# Only the first data row of each input, with or without a header
+../../mmpio --config config.json --output data_out_head.tsv --head 1
+diff data_expected_head.tsv data_out_head.tsv
+
+# Configuration with the defaults filled in
+../../mmpio --config config.json --print-config > data_out_config.json
+diff data_expected_config.json data_out_config.json
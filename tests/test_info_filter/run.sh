@@ -0,0 +1,22 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# Variants with an INFO below `info_threshold` are neither selected nor
+# reported, the ones with a missing INFO are kept
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# `info_threshold` needs `col_info`
+! ../../mmpio --config config_no_col_info.json --output data_out_no_col_info.tsv 2> data_out_no_col_info.log
+grep "Input \`Dataset1\` has \`info_threshold\` but no \`col_info\`." data_out_no_col_info.log
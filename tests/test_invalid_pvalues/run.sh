@@ -0,0 +1,23 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats.tsv | gzip > data_sumstats.tsv.gz
+
+# Run end-to-end test: p-values outside of [0, 1] are clamped or skipped
+../../mmpio --config config.json --output data_out.tsv --rejected-log data_out_rejected.tsv --neglog10p
+
+diff data_expected.tsv data_out.tsv
+# The inputs are read concurrently, only the rows of one input are in order
+grep Skipped data_out_rejected.tsv > data_out_skipped.tsv
+diff data_expected_skipped.tsv data_out_skipped.tsv
+
+# Or stop with an error
+! ../../mmpio --config config_fail.json --output data_out_fail.tsv
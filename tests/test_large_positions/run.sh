@@ -0,0 +1,31 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_large_positions.tsv | gzip > data_sumstats_large_positions.tsv.gz
+
+# Positions near and beyond 2^31 and 2^32, clumped within 100 bp
+../../mmpio --config config.json --output data_out.tsv --selected-bed data_out_selected.bed --clump-window 100
+
+diff data_expected.tsv data_out.tsv
+diff data_expected_selected.bed data_out_selected.bed
+
+# The BED output is written like the other outputs: gzip-compressed for a .gz
+# path, with the mode of the outputs, and in place of a previous file only
+# once complete. The line terminator options only apply to the TSV outputs.
+echo "previous" | gzip > data_out_selected.bed.gz
+../../mmpio --config config.json --output data_out.tsv --selected-bed data_out_selected.bed.gz --clump-window 100 --line-terminator crlf --no-trailing-newline --output-mode 0600
+zcat data_out_selected.bed.gz | diff data_expected_selected.bed -
+test $(stat -c %a data_out_selected.bed.gz) = 600
+
+# Without --output-mode, the umask applies as for a file created in place
+(umask 027 && ../../mmpio --config config.json --output data_out.tsv --selected-bed data_out_selected.bed.gz --clump-window 100)
+test $(stat -c %a data_out_selected.bed.gz) = 640
+test -z "$(ls -A | grep '\.tmp$' || true)"
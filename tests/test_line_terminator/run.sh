@@ -0,0 +1,36 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# Windows line endings
+../../mmpio --config config.json --output data_out_crlf.tsv --line-terminator crlf
+sed 's/$/\r/' data_expected.tsv | cmp - data_out_crlf.tsv
+
+# No line terminator after the last line, with both line endings
+../../mmpio --config config.json --output data_out_no_trailing.tsv --no-trailing-newline
+head -c -1 data_expected.tsv | cmp - data_out_no_trailing.tsv
+../../mmpio --config config.json --output data_out_crlf_no_trailing.tsv --line-terminator crlf --no-trailing-newline
+sed 's/$/\r/' data_expected.tsv | head -c -2 | cmp - data_out_crlf_no_trailing.tsv
+
+# The VCF and the saved selection are not TSV outputs, their lines always end
+# with \n, including the last one
+../../mmpio --config config.json --output data_out_other.tsv --line-terminator crlf --no-trailing-newline --vcf-output data_out.vcf --save-selection data_out_selection.tsv
+! grep -q $'\r' data_out.vcf data_out_selection.tsv
+[ "$(tail -c 1 data_out.vcf | od -An -c | tr -d ' ')" = '\n' ]
+[ "$(tail -c 1 data_out_selection.tsv | od -An -c | tr -d ' ')" = '\n' ]
+
+! ../../mmpio --config config.json --output data_out_cr.tsv --line-terminator cr 2> data_out_cr.log
+grep "Unrecognized --line-terminator \`cr\`. Possible values are: lf, crlf." data_out_cr.log
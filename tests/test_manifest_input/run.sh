@@ -0,0 +1,30 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_chr1.tsv | gzip > data_sumstats_chr1.tsv.gz
+cat data_sumstats_chr2.tsv | gzip > data_sumstats_chr2.tsv.gz
+
+# Run end-to-end test
+../../mmpio --config config.json --output data_out.tsv
+
+diff data_expected.tsv data_out.tsv
+
+# Finemap files given as a manifest too
+../../mmpio --config config_finemap.json --output data_out_finemap.tsv
+
+diff data_expected_finemap.tsv data_out_finemap.tsv
+
+# The fingerprint is stable, and changes with the options and the input files
+fingerprint=$(../../mmpio --config config_finemap.json --fingerprint)
+[ "$fingerprint" = "$(../../mmpio --config config_finemap.json --fingerprint)" ]
+[ "$fingerprint" != "$(../../mmpio --config config_finemap.json --fingerprint --gzip-level 1)" ]
+touch -d '2000-01-01' data_sumstats_chr2.tsv.gz
+[ "$fingerprint" != "$(../../mmpio --config config_finemap.json --fingerprint)" ]
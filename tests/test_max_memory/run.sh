@@ -0,0 +1,26 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# A limit too low for the run: the readers of the inputs pause to free memory,
+# then go on with a warning, and the output is the same
+../../mmpio --config config.json --output data_out.tsv --max-memory 1K 2> data_out_memory.log
+diff data_expected.tsv data_out.tsv
+grep "WARNING: the data kept by the run, mostly the selected variants and their stats, takes [0-9]* MB, above --max-memory 1K" data_out_memory.log
+
+../../mmpio --config config.json --output data_out_high.tsv --max-memory 8G 2> data_out_high.log
+diff data_expected.tsv data_out_high.tsv
+! grep "above --max-memory" data_out_high.log
+
+! ../../mmpio --config config.json --output data_out_invalid.tsv --max-memory 0 2> data_out_invalid.log
+grep "parsing --max-memory" data_out_invalid.log
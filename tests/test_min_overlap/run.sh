@@ -0,0 +1,26 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# Only 1 of the 3 selected variants has stats from both inputs, below the
+# `min_overlap` of meta1: a warning by default, an error with
+# `"on_low_overlap": "fail"`
+../../mmpio --config config.json --output data_out.tsv 2> data_out_warn.log
+grep "WARNING: Only 1 of the 3 selected variants of heterogeneity test \`meta1\` have stats from at least 2 of its inputs" data_out_warn.log
+
+! ../../mmpio --config config_fail.json --output data_out_fail.tsv 2> data_out_fail.log
+grep "Only 1 of the 3 selected variants of heterogeneity test \`meta1\`" data_out_fail.log
+
+# No warning above `min_overlap`
+../../mmpio --config config_pass.json --output data_out_pass.tsv 2> data_out_pass.log
+! grep "selected variants of heterogeneity test" data_out_pass.log
@@ -0,0 +1,17 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats.tsv | gzip > data_sumstats.tsv.gz
+
+# A multi-allelic row is split into one row per alt allele: the p-value, beta,
+# sebeta and af are split, the passthrough list of genes is kept as is
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
@@ -0,0 +1,17 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+
+# The variants are selected on the smallest of their additive and dominant
+# p-values, ignoring a missing one, and the output has this smallest p-value
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
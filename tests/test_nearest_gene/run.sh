@@ -0,0 +1,22 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats.tsv | gzip > data_sumstats.tsv.gz
+cat data_genes.gtf | gzip > data_genes.gtf.gz
+
+# Run end-to-end test
+../../mmpio --config config.json --output data_out.tsv --genes data_genes.bed
+
+diff data_expected.tsv data_out.tsv
+
+# Same genes from a GTF file, with gene_id when there is no gene_name
+../../mmpio --config config.json --output data_out_gtf.tsv --genes data_genes.gtf.gz
+diff data_expected_gtf.tsv data_out_gtf.tsv
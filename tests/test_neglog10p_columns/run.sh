@@ -0,0 +1,18 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# -log10(p) of each input, and signed with the sign of its beta. They are
+# missing without a p-value, and only the signed one without a beta.
+../../mmpio --config config.json --output data_out.tsv --neglog10p
+diff data_expected.tsv data_out.tsv
@@ -0,0 +1,21 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+# The configured finemapping is skipped, and the output has no PIP and CS
+# columns
+../../mmpio --config config.json --output data_out_no_finemap.tsv --no-finemap
+diff data_expected_no_finemap.tsv data_out_no_finemap.tsv
@@ -0,0 +1,19 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# The LOG10P column of Dataset2 is converted back to p-values before the
+# variant selection: 4:400 is selected with a p-value of 1e-8, and 3:300 is
+# not, its -log10(p) of 1e-7 being a p-value of about 1
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
@@ -10,8 +10,49 @@ source ${tdir}/../common.sh
 build_mmpio
 
 cat data_sumstats_2rows.tsv | gzip > data_sumstats_2rows.tsv.gz
+cat data_sumstats_4rows.tsv | gzip > data_sumstats_4rows.tsv.gz
 
 # Run end-to-end test
 ../../mmpio --config config.json --output data_out.tsv
 
 diff data_expected.tsv data_out.tsv
+
+# Thresholds derived from the number of tested variants
+../../mmpio --config config_bonferroni.json --output data_out_bonferroni.tsv
+diff data_expected_bonferroni.tsv data_out_bonferroni.tsv
+
+../../mmpio --config config_fdr.json --output data_out_fdr.tsv
+diff data_expected_fdr.tsv data_out_fdr.tsv
+
+# Suggestive variants, passing only the looser threshold of the inputs
+../../mmpio --config config_suggestive.json --output data_out_suggestive.tsv
+diff data_expected_suggestive.tsv data_out_suggestive.tsv
+
+# No variant passes the threshold: header-only output, or an error when asked
+../../mmpio --config config_empty.json --output data_out_empty.tsv 2>&1 | grep "WARNING: No variant passes"
+diff data_expected_empty.tsv data_out_empty.tsv
+! ../../mmpio --config config_empty.json --output data_out_empty.tsv --fail-on-empty-selection
+
+# Too many selected variants: an error, or only the most significant ones with a warning
+! ../../mmpio --config config_suggestive.json --output data_out_max_selected.tsv --max-selected 3
+../../mmpio --config config_suggestive.json --output data_out_max_selected.tsv --max-selected 2 --truncate-selected 2>&1 | grep "WARNING: 4 variants are selected"
+diff data_expected_max_selected.tsv data_out_max_selected.tsv
+
+# Named thresholds instead of numbers
+../../mmpio --config config_presets.json --output data_out_presets.tsv
+diff data_expected_presets.tsv data_out_presets.tsv
+sed 's/"genome_wide"/"genomewide"/' config_presets.json > data_out_presets_typo.json
+! ../../mmpio --config data_out_presets_typo.json --output data_out_presets.tsv 2> data_out_presets_typo.log
+grep "unrecognized p-value threshold \`genomewide\`" data_out_presets_typo.log
+
+# Selection saved in a run and read back in another one, skipping the scan of the inputs
+../../mmpio --config config_suggestive.json --output data_out_suggestive.tsv --save-selection data_out_selection.tsv.gz
+zcat data_out_selection.tsv.gz > data_out_selection.tsv
+diff data_expected_selection.tsv data_out_selection.tsv
+../../mmpio --config config_suggestive.json --output data_out_from_selection.tsv --selection data_out_selection.tsv.gz
+diff data_expected_suggestive.tsv data_out_from_selection.tsv
+
+# Only the discovery inputs define the variant selection
+../../mmpio --config config_replication.json --output data_out_replication.tsv --report data_out_replication_report.json
+diff data_expected_replication.tsv data_out_replication.tsv
+diff data_expected_replication_report.json data_out_replication_report.json
@@ -0,0 +1,42 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+cat data_sumstats_pval_only.tsv | gzip > data_sumstats_pval_only.tsv.gz
+cat data_sumstats_strong1.tsv | gzip > data_sumstats_strong1.tsv.gz
+cat data_sumstats_strong2.tsv | gzip > data_sumstats_strong2.tsv.gz
+
+
+# Run end-to-end test
+
+# Fisher: p = P * (1 - ln(P)) with P = 0.01 * 0.02 for 2 studies
+../../mmpio --config config_fisher.json --output data_out_fisher.tsv
+
+diff data_expected_fisher.tsv data_out_fisher.tsv
+
+# Stouffer weighted by sqrt(N)
+../../mmpio --config config_stouffer.json --output data_out_stouffer.tsv
+
+diff data_expected_stouffer.tsv data_out_stouffer.tsv
+
+../../mmpio --config config_sample_size_check.json --output data_out_sample_size_check.tsv --af-mean
+diff data_expected_sample_size_check.tsv data_out_sample_size_check.tsv
+
+# The inverse-variance weighted p-value underflows, but the ratio is still
+# computed from its -log10
+../../mmpio --config config_sample_size_check_strong.json --output data_out_sample_size_check_strong.tsv
+diff data_expected_sample_size_check_strong.tsv data_out_sample_size_check_strong.tsv
+
+# Without beta and sebeta, Dataset2 still contributes its p-value to Fisher's
+# combination, but not to Stouffer's which needs the direction of effect
+../../mmpio --config config_pval_only.json --output data_out_pval_only.tsv
+diff data_expected_pval_only.tsv data_out_pval_only.tsv
@@ -0,0 +1,30 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# Run end-to-end test. 1:100 is swapped in Dataset2, so its meta-analysis with
+# the alleles of the reference has the flipped beta of Dataset2, which keeps its
+# own stats under its own alleles. 3:400 is the same but only selected in
+# Dataset2. 1:200 has other alleles in Dataset2, so it can't be aligned.
+../../mmpio --config config.json --output data_out.tsv 2> data_out_warning.log
+grep "WARNING: 1 variants of the reference \`Dataset1\` of heterogeneity test \`meta1\` could not be aligned in \`Dataset2\`" data_out_warning.log
+! grep "alleles swapped or on the other strand" data_out_warning.log
+diff data_expected.tsv data_out.tsv
+
+# The finemapping of the swapped variant is matched on the alleles of Dataset2
+../../mmpio --config config_finemap.json --output data_out_finemap.tsv
+diff data_expected_finemap.tsv data_out_finemap.tsv
+
+# The betas of the aligned variants pass the self-check
+../../mmpio --config config.json --output data_out_self_check.tsv --self-check | grep "self-check passed"
+diff data_expected.tsv data_out_self_check.tsv
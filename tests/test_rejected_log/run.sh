@@ -0,0 +1,17 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+
+# Each variant dropped from the input is logged with the reason why
+../../mmpio --config config.json --output data_out.tsv --rejected-log data_out_rejected.tsv
+diff data_expected.tsv data_out.tsv
+diff data_expected_rejected.tsv data_out_rejected.tsv
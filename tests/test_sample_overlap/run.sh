@@ -0,0 +1,25 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_cohort1.tsv | gzip > data_sumstats_cohort1.tsv.gz
+cat data_sumstats_cohort2.tsv | gzip > data_sumstats_cohort2.tsv.gz
+cat data_sumstats_cohort3.tsv | gzip > data_sumstats_cohort3.tsv.gz
+
+# Run end-to-end test: independent inputs, then inputs sharing samples
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+
+../../mmpio --config config_overlap.json --output data_out_overlap.tsv
+diff data_expected_overlap.tsv data_out_overlap.tsv
+
+# Correlations that no covariance can have
+! ../../mmpio --config config_not_positive_definite.json --output data_out.tsv 2> data_out_not_positive_definite.log
+grep "are not the ones of a positive definite correlation matrix" data_out_not_positive_definite.log
@@ -0,0 +1,25 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+cat data_sumstats_dataset2.tsv | gzip > data_sumstats_dataset2.tsv.gz
+
+# --seed is reserved for methods drawing random samples: as the current methods
+# are deterministic, the output is the same with and without a seed
+../../mmpio --config config.json --output data_out.tsv
+diff data_expected.tsv data_out.tsv
+../../mmpio --config config.json --output data_out_seed1.tsv --seed 42
+diff data_expected.tsv data_out_seed1.tsv
+../../mmpio --config config.json --output data_out_seed2.tsv --seed 7
+diff data_expected.tsv data_out_seed2.tsv
+
+! ../../mmpio --config config.json --output data_out_invalid.tsv --seed -1 2> data_out_invalid.log
+grep "invalid value \"-1\" for flag -seed" data_out_invalid.log
@@ -0,0 +1,17 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+cat data_sumstats_dataset1.tsv | gzip > data_sumstats_dataset1.tsv.gz
+
+# The selected variants as 0-based half-open intervals covering their ref
+# allele, sorted by position. The variant not passing the threshold is left out.
+../../mmpio --config config.json --output data_out.tsv --selected-bed data_out_selected.bed
+diff data_expected_selected.bed data_out_selected.bed
@@ -0,0 +1,29 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+for ii in 1 2 3 4; do
+    cat data_sumstats_dataset${ii}.tsv | gzip > data_sumstats_dataset${ii}.tsv.gz
+done
+
+# Each input has a different significant variant. Dataset1 and Dataset2 are
+# compared in meta1, Dataset2 and Dataset3 in meta2, Dataset4 in no test.
+../../mmpio --config config.json --output data_out_all.tsv
+cut -f 1-4 data_out_all.tsv > data_out_all_variants.tsv
+diff data_expected_all_variants.tsv data_out_all_variants.tsv
+
+# Only the inputs compared in some heterogeneity test select variants
+../../mmpio --config config.json --output data_out_tests.tsv --selection-scope tests
+cut -f 1-4 data_out_tests.tsv > data_out_tests_variants.tsv
+diff data_expected_tests_variants.tsv data_out_tests_variants.tsv
+
+# Only the inputs compared in meta1 select variants
+../../mmpio --config config.json --output data_out_meta1.tsv --selection-scope meta1
+diff data_expected_meta1.tsv data_out_meta1.tsv
@@ -0,0 +1,27 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+
+# Run end-to-end test, on the plain TSV file
+../../mmpio --config config.json --output data_out.tsv
+
+diff data_expected.tsv data_out.tsv
+
+# Compression detected from the extension
+../../mmpio --config config_auto.json --output data_out_auto.tsv
+
+diff data_expected.tsv data_out_auto.tsv
+
+# Compression detected from the gzip magic number, despite the extension
+cat data_sumstats_2rows.tsv | gzip > data_sumstats_2rows_gzip.txt
+../../mmpio --config config_mislabeled.json --output data_out_mislabeled.tsv
+
+diff data_expected.tsv data_out_mislabeled.tsv
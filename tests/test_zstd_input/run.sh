@@ -0,0 +1,16 @@
+#! /usr/bin/env bash
+set -euxo pipefail
+
+# Setup test
+tdir=$(dirname $(realpath $0))
+cd $tdir
+
+source ${tdir}/../common.sh
+
+build_mmpio
+
+# Run end-to-end test, data_sumstats_2rows.tsv.zst is data_sumstats_2rows.tsv
+# compressed with zstd, committed as the zstd tool is not always installed
+../../mmpio --config config.json --output data_out.tsv
+
+diff data_expected.tsv data_out.tsv